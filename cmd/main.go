@@ -2,18 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	bl "github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/admin"
+	"github.com/SlashLight/golang-balancer/internal/api"
 	"github.com/SlashLight/golang-balancer/internal/config"
-	health_check "github.com/SlashLight/golang-balancer/internal/health-check"
 	"github.com/SlashLight/golang-balancer/internal/logger"
+	"github.com/SlashLight/golang-balancer/internal/metrics"
 	"github.com/SlashLight/golang-balancer/internal/middleware"
 	"github.com/SlashLight/golang-balancer/internal/rate-limiter/controller"
 	"github.com/SlashLight/golang-balancer/internal/rate-limiter/storage"
+	"github.com/SlashLight/golang-balancer/internal/reloader"
+	"github.com/SlashLight/golang-balancer/internal/router"
+	"github.com/SlashLight/golang-balancer/internal/tracing"
 )
 
 const (
@@ -32,52 +40,118 @@ func main() {
 		slog.String("env", cfg.Env),
 	)
 
-	balancer, err := bl.NewBalancer(cfg.Balancer.Algorithm, cfg.Balancer.Backends)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Error("failed to init balancer", logger.Err(err))
+		log.Error("failed to init tracing", logger.Err(err))
 		os.Exit(1)
 	}
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	})
+	rt, err := router.NewRouter(cfg, log)
+	if err != nil {
+		log.Error("failed to init router", logger.Err(err))
+		os.Exit(1)
+	}
 
-	maxRetries := cfg.Retries
-	limiter := storage.NewRedisRateLimiter(cfg)
-	if err = limiter.Client.Ping(context.Background()).Err(); err != nil {
-		log.Error("Error connecting to Redis", logger.Err(err))
+	if err = metrics.RegisterBackends(rt); err != nil {
+		log.Error("failed to register backend metrics", logger.Err(err))
 		os.Exit(1)
 	}
 
-	chain := middleware.RateLimitMiddleware(limiter, log)(
-		middleware.AccessLog(log)(
-			middleware.RetryMiddleware(balancer, log, maxRetries)(
-				handler,
-			),
-		))
-	clientHandler := middleware.AccessLog(log)(controller.NewRateLimitController(limiter, log))
+	limiter, err := storage.NewRateLimiter(context.Background(), cfg, log)
+	if err != nil {
+		log.Error("failed to init rate limiter", logger.Err(err))
+		os.Exit(1)
+	}
+
+	requestID := middleware.RequestID(cfg.RequestID)
+	chain := requestID(
+		tracing.Middleware(
+			middleware.RateLimitMiddleware(limiter, log)(
+				middleware.AccessLog(log)(
+					rt,
+				))))
+	clientHandler := requestID(middleware.AccessLog(log)(controller.NewRateLimitController(limiter, log)))
+
+	readiness := api.NewReadiness(log)
 
 	mux := http.NewServeMux()
 	mux.Handle("/", chain)
 	mux.Handle("/clients", clientHandler)
+	mux.Handle("/ready", readiness)
+	if cfg.Admin.Port == 0 {
+		mux.Handle(cfg.Metrics.Path, metrics.Handler())
+	}
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Addr:    fmt.Sprintf(":%d", cfg.Balancer.Port),
 		Handler: mux,
 	}
 
-	checker, err := health_check.NewHealthChecker(cfg.HealthChecker.Interval,
-		cfg.Backends,
-		cfg.HealthChecker.CheckURL,
-		log)
-	if err != nil {
-		log.Error("failed to init health checker", logger.Err(err))
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	checkCtx, stopChecks := context.WithCancel(context.Background())
+	rt.StartHealthChecks(checkCtx)
+
+	var adminServer *http.Server
+	if cfg.Admin.Port != 0 {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/backends", requestID(middleware.AccessLog(log)(admin.NewBackendController(rt, log))))
+		adminMux.Handle("/ready", readiness)
+		adminMux.Handle(cfg.Metrics.Path, metrics.Handler())
+		adminServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.Admin.Port),
+			Handler: adminMux,
+		}
+
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("failed to start admin server", logger.Err(err))
+			}
+		}()
 	}
 
-	go checker.Start(balancer)
+	configReloader := reloader.NewReloader(os.Getenv("CONFIG_PATH"), cfg, rt, limiter, log)
+	go configReloader.Run(ctx, cfg.Reload.WatchInterval)
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Error("failed to start server", logger.Err(err))
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start server", logger.Err(err))
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Info("shutting down golang balancer",
+		slog.String("delay", cfg.ShutdownDelay.String()),
+		slog.String("timeout", cfg.ShutdownTimeout.String()),
+	)
+	readiness.SetReady(false)
+	// даем внешним балансировщикам увидеть 503 на /ready, пока слушатель еще открыт
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to wait for in-flight requests", logger.Err(err))
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			log.Error("failed to shutdown admin server", logger.Err(err))
+		}
 	}
+
+	stopChecks()
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error("failed to flush traces", logger.Err(err))
+	}
+
+	if err := limiter.Close(); err != nil {
+		log.Error("failed to close rate limiter", logger.Err(err))
+	}
+
+	log.Info("golang balancer stopped")
 }
 
 func setupLogger(env string) *slog.Logger {
@@ -87,11 +161,11 @@ func setupLogger(env string) *slog.Logger {
 	case envLocal:
 		log = setupPrettySlog()
 	case envProd:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		log = slog.New(logger.NewContextHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
 	case envDev:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		log = slog.New(logger.NewContextHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
 	default:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		log = slog.New(logger.NewContextHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
 	}
 
 	return log
@@ -106,5 +180,5 @@ func setupPrettySlog() *slog.Logger {
 
 	handler := opts.NewPrettyHandler(os.Stdout)
 
-	return slog.New(handler)
+	return slog.New(logger.NewContextHandler(handler))
 }
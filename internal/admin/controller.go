@@ -0,0 +1,213 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	resp "github.com/SlashLight/golang-balancer/internal/api/response"
+	bl "github.com/SlashLight/golang-balancer/internal/balancer"
+	health_check "github.com/SlashLight/golang-balancer/internal/health-check"
+	"github.com/SlashLight/golang-balancer/internal/logger"
+	"github.com/SlashLight/golang-balancer/internal/router"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+type PoolRegistry interface {
+	Pools() map[string]*router.Pool
+	Pool(string) (*router.Pool, bool)
+}
+
+type BackendInfo struct {
+	Upstream    string                      `json:"upstream"`
+	URL         string                      `json:"url"`
+	Alive       bool                        `json:"alive"`
+	Ejected     bool                        `json:"ejected"`
+	Breaker     string                      `json:"breaker,omitempty"`
+	State       string                      `json:"state"`
+	Connections int64                       `json:"connections"`
+	Weight      int                         `json:"weight"`
+	Health      *health_check.BackendHealth `json:"health,omitempty"`
+}
+
+type BackendRequest struct {
+	Upstream string `json:"upstream"`
+	URL      string `json:"url"`
+	Weight   int    `json:"weight,omitempty"`
+	State    string `json:"state,omitempty"`
+}
+
+type BackendController struct {
+	Pools PoolRegistry
+	Log   *slog.Logger
+}
+
+func NewBackendController(pools PoolRegistry, log *slog.Logger) *BackendController {
+	return &BackendController{Pools: pools, Log: log}
+}
+
+func (c *BackendController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.HandleBackends(w, r)
+}
+
+func (c *BackendController) HandleBackends(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var pools []*router.Pool
+		if name := r.URL.Query().Get("upstream"); name != "" {
+			pool, ok := c.Pools.Pool(name)
+			if !ok {
+				resp.RespondError(w, http.StatusNotFound, "upstream not found", c.Log)
+				return
+			}
+			pools = append(pools, pool)
+		} else {
+			for _, pool := range c.Pools.Pools() {
+				pools = append(pools, pool)
+			}
+		}
+
+		backendURL := r.URL.Query().Get("url")
+		backends := make([]BackendInfo, 0)
+		for _, pool := range pools {
+			for _, back := range pool.Backends() {
+				if backendURL != "" && back.URL.String() != backendURL {
+					continue
+				}
+				info := newBackendInfo(pool.Name, back)
+				info.Breaker = string(pool.Breaker.State(back))
+				if health, ok := pool.Checker.Health(back); ok {
+					info.Health = &health
+				}
+				backends = append(backends, info)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(backends); err != nil {
+			c.Log.ErrorContext(r.Context(), "error at sending JSON", logger.Err(err))
+		}
+	case http.MethodPost:
+		var req BackendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			c.Log.ErrorContext(r.Context(), "error at getting backend from request body", logger.Err(err))
+			resp.RespondError(w, http.StatusBadRequest, "invalid request body", c.Log)
+			return
+		}
+
+		pool, ok := c.pool(w, req.Upstream, req.URL)
+		if !ok {
+			return
+		}
+
+		if _, err := pool.AddBackend(req.URL, req.Weight); err != nil {
+			c.Log.ErrorContext(r.Context(), "error at adding backend", logger.Err(err))
+			c.respondPoolError(w, err)
+			return
+		}
+
+		resp.RespondOK(w, http.StatusOK, c.Log)
+	case http.MethodPut:
+		var req BackendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			c.Log.ErrorContext(r.Context(), "error at getting backend from request body", logger.Err(err))
+			resp.RespondError(w, http.StatusBadRequest, "invalid request body", c.Log)
+			return
+		}
+
+		pool, ok := c.pool(w, req.Upstream, req.URL)
+		if !ok {
+			return
+		}
+
+		if req.Weight != 0 {
+			if err := pool.SetWeight(req.URL, req.Weight); err != nil {
+				c.Log.ErrorContext(r.Context(), "error at updating backend weight", logger.Err(err))
+				c.respondPoolError(w, err)
+				return
+			}
+		}
+
+		if req.State != "" {
+			if err := pool.SetState(req.URL, bl.BackendState(req.State)); err != nil {
+				c.Log.ErrorContext(r.Context(), "error at updating backend state", logger.Err(err))
+				c.respondPoolError(w, err)
+				return
+			}
+		}
+
+		resp.RespondOK(w, http.StatusOK, c.Log)
+	case http.MethodDelete:
+		query := r.URL.Query()
+		pool, ok := c.pool(w, query.Get("upstream"), query.Get("url"))
+		if !ok {
+			return
+		}
+
+		if err := pool.RemoveBackend(query.Get("url")); err != nil {
+			c.Log.ErrorContext(r.Context(), "error at removing backend", logger.Err(err))
+			c.respondPoolError(w, err)
+			return
+		}
+
+		resp.RespondOK(w, http.StatusOK, c.Log)
+	default:
+		resp.RespondError(w, http.StatusMethodNotAllowed, "method not allowed", c.Log)
+	}
+}
+
+// pool находит пул по имени. Имя можно не указывать, если пул единственный.
+func (c *BackendController) pool(w http.ResponseWriter, name, backendURL string) (*router.Pool, bool) {
+	if backendURL == "" {
+		c.Log.Error("empty backend URL")
+		resp.RespondError(w, http.StatusBadRequest, "no backend URL", c.Log)
+		return nil, false
+	}
+
+	if name == "" {
+		pools := c.Pools.Pools()
+		if len(pools) != 1 {
+			resp.RespondError(w, http.StatusBadRequest, "no upstream name", c.Log)
+			return nil, false
+		}
+		for _, pool := range pools {
+			return pool, true
+		}
+	}
+
+	pool, ok := c.Pools.Pool(name)
+	if !ok {
+		resp.RespondError(w, http.StatusNotFound, "upstream not found", c.Log)
+		return nil, false
+	}
+
+	return pool, true
+}
+
+func (c *BackendController) respondPoolError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, my_err.ErrBackendNotFound):
+		resp.RespondError(w, http.StatusNotFound, err.Error(), c.Log)
+	case errors.Is(err, my_err.ErrBackendExists),
+		errors.Is(err, my_err.ErrParsingBackendURL),
+		errors.Is(err, my_err.ErrInvalidWeight),
+		errors.Is(err, my_err.ErrWeightNotSupported),
+		errors.Is(err, my_err.ErrUnknownState):
+		resp.RespondError(w, http.StatusBadRequest, err.Error(), c.Log)
+	default:
+		resp.RespondError(w, http.StatusInternalServerError, "internal error", c.Log)
+	}
+}
+
+func newBackendInfo(upstream string, back *bl.Backend) BackendInfo {
+	return BackendInfo{
+		Upstream:    upstream,
+		URL:         back.URL.String(),
+		Alive:       back.IsAlive(),
+		Ejected:     back.Ejected(),
+		State:       string(back.State()),
+		Connections: back.Connections(),
+		Weight:      back.GetWeight(),
+	}
+}
@@ -1,16 +1,113 @@
 package api
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
+	"sync/atomic"
 )
 
+// trustedProxies - адреса прокси (CDN, внешних балансировщиков), которым доверяем
+// заголовки X-Forwarded-For и X-Real-IP
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+// ParseTrustedProxies разбирает список подсетей вида "10.0.0.0/8" или отдельных адресов
+func ParseTrustedProxies(raw []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(raw))
+	for _, item := range raw {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("bad trusted proxy %q: %w", item, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted proxy %q: %w", item, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func SetTrustedProxies(prefixes []netip.Prefix) {
+	trustedProxies.Store(&prefixes)
+}
+
+func IsTrustedProxy(addr netip.Addr) bool {
+	prefixes := trustedProxies.Load()
+	if prefixes == nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range *prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PeerIP возвращает адрес, с которого пришло соединение
+func PeerIP(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return addr.Unmap(), nil
+}
+
+// ClientIP возвращает адрес клиента. Если запрос пришел от доверенного прокси, адрес берется
+// из X-Forwarded-For: первый справа адрес, не принадлежащий доверенным прокси, или X-Real-IP.
+func ClientIP(r *http.Request) (netip.Addr, error) {
+	peer, err := PeerIP(r)
+	if err != nil || !IsTrustedProxy(peer) {
+		return peer, err
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := peer
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !IsTrustedProxy(client) {
+			return client, nil
+		}
+	}
+	if client != peer {
+		return client, nil
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap(), nil
+	}
+
+	return peer, nil
+}
+
 func GetIpFromRequest(r *http.Request) (string, error) {
-	userIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	userIP, err := ClientIP(r)
 	if err != nil {
 		return "", err
 	}
-	userIP = strings.Replace(userIP, ":", "_", -1)
-	return userIP, nil
+
+	return strings.Replace(userIP.String(), ":", "_", -1), nil
 }
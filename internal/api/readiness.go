@@ -0,0 +1,34 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	resp "github.com/SlashLight/golang-balancer/internal/api/response"
+)
+
+// Readiness отвечает 200, пока балансировщик готов принимать трафик, и 503 после начала остановки
+type Readiness struct {
+	ready atomic.Bool
+	log   *slog.Logger
+}
+
+func NewReadiness(log *slog.Logger) *Readiness {
+	rd := &Readiness{log: log}
+	rd.ready.Store(true)
+	return rd
+}
+
+func (rd *Readiness) SetReady(ready bool) {
+	rd.ready.Store(ready)
+}
+
+func (rd *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !rd.ready.Load() {
+		resp.RespondError(w, http.StatusServiceUnavailable, "shutting down", rd.log)
+		return
+	}
+
+	resp.RespondOK(w, http.StatusOK, rd.log)
+}
@@ -3,15 +3,62 @@ package balancer
 import (
 	"net/url"
 	"sync"
+	"sync/atomic"
 
 	"github.com/SlashLight/golang-balancer/pkg/my_err"
 )
 
+const DefaultWeight = 1
+
+type BackendState string
+
+const (
+	// StateActive - бэкенд получает трафик, если жив
+	StateActive BackendState = "active"
+	// StateDisabled - бэкенд выведен из балансировки вручную
+	StateDisabled BackendState = "disabled"
+	// StateDraining - новые запросы не отправляются, ждем завершения текущих
+	StateDraining BackendState = "draining"
+	// StateDrained - дренаж завершен, запросов в обработке нет (или истек таймаут)
+	StateDrained BackendState = "drained"
+)
+
+// nextBackendID выдает уникальные в рамках процесса идентификаторы (Backend.Index)
+var nextBackendID atomic.Int64
+
 type Backend struct {
-	URL   *url.URL
-	Alive bool
-	Index int
-	mu    sync.RWMutex
+	URL         *url.URL
+	Alive       bool
+	Index       int
+	Weight      int
+	state       BackendState
+	ejected     bool
+	tripped     bool
+	connections atomic.Int64
+	mu          sync.RWMutex
+	syncMu      sync.Mutex
+}
+
+// BackendSet - балансировщик, в который бэкенды добавляются и из которого убираются
+type BackendSet interface {
+	AddNewBackend(*Backend)
+	RemoveBackend(int)
+}
+
+func NewBackend(rawURL string) (*Backend, error) {
+	backURL, err := url.Parse(rawURL)
+	if err != nil || backURL.Host == "" {
+		return nil, my_err.ErrParsingBackendURL
+	}
+
+	return &Backend{
+		URL:    backURL,
+		Alive:  true,
+		Index:  int(nextBackendID.Add(1)),
+		Weight: DefaultWeight,
+		state:  StateActive,
+		mu:     sync.RWMutex{},
+	}, nil
 }
 
 func (b *Backend) SetAlive(status bool) {
@@ -20,20 +67,107 @@ func (b *Backend) SetAlive(status bool) {
 	b.mu.Unlock()
 }
 
+func (b *Backend) IsAlive() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.Alive
+}
+
+func (b *Backend) SetWeight(weight int) {
+	b.mu.Lock()
+	b.Weight = weight
+	b.mu.Unlock()
+}
+
+func (b *Backend) GetWeight() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.Weight
+}
+
+func (b *Backend) SetState(state BackendState) {
+	b.mu.Lock()
+	b.state = state
+	b.mu.Unlock()
+}
+
+func (b *Backend) State() BackendState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.state
+}
+
+// SetEjected помечает бэкенд, временно исключенный пассивной проверкой.
+// Флаг не трогает Alive, чтобы не спорить с активным health checker'ом.
+func (b *Backend) SetEjected(ejected bool) {
+	b.mu.Lock()
+	b.ejected = ejected
+	b.mu.Unlock()
+}
+
+func (b *Backend) Ejected() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.ejected
+}
+
+// SetTripped помечает бэкенд с разомкнутым circuit breaker'ом
+func (b *Backend) SetTripped(tripped bool) {
+	b.mu.Lock()
+	b.tripped = tripped
+	b.mu.Unlock()
+}
+
+func (b *Backend) Tripped() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.tripped
+}
+
+// Available сообщает, можно ли отправлять на бэкенд новые запросы
+func (b *Backend) Available() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.Alive && !b.ejected && !b.tripped && b.state == StateActive
+}
+
+// Sync добавляет бэкенд в lb, если он доступен, и убирает в противном случае. Вызывается после
+// каждой смены состояния. Health checker, outlier detection, circuit breaker и admin API меняют
+// состояние независимо, поэтому проверка и изменение пула идут под одним мьютексом: последний
+// Sync видит все предыдущие изменения, и пул соответствует итоговому состоянию.
+func (b *Backend) Sync(lb BackendSet) {
+	b.syncMu.Lock()
+	defer b.syncMu.Unlock()
+
+	if b.Available() {
+		lb.AddNewBackend(b)
+	} else {
+		lb.RemoveBackend(b.Index)
+	}
+}
+
+// IncConnections и DecConnections вызываются прокси вокруг каждого запроса к бэкенду
+func (b *Backend) IncConnections() {
+	b.connections.Add(1)
+}
+
+func (b *Backend) DecConnections() {
+	b.connections.Add(-1)
+}
+
+func (b *Backend) Connections() int64 {
+	return b.connections.Load()
+}
+
 func GetBackendsFromURLS(backendsURLs []string) ([]*Backend, error) {
 	backends := make([]*Backend, len(backendsURLs))
 	for idx := range backends {
-		backURL, err := url.Parse(backendsURLs[idx])
+		back, err := NewBackend(backendsURLs[idx])
 		if err != nil {
-			return nil, my_err.ErrParsingBackendURL
+			return nil, err
 		}
 
-		backends[idx] = &Backend{
-			URL:   backURL,
-			Alive: true,
-			Index: idx,
-			mu:    sync.RWMutex{},
-		}
+		backends[idx] = back
 	}
 
 	return backends, nil
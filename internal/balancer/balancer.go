@@ -3,6 +3,7 @@ package balancer
 import (
 	"net/http"
 
+	"github.com/SlashLight/golang-balancer/internal/config"
 	"github.com/SlashLight/golang-balancer/pkg/my_err"
 )
 
@@ -10,24 +11,35 @@ type Balancer interface {
 	Next(r *http.Request) (*Backend, error)
 	AddNewBackend(*Backend)
 	RemoveBackend(int)
+	Backends() []*Backend
 }
 
 const (
-	RoundRobinAlgorithm = "round-robin"
-	HashAlgorithm       = "hash"
-	LeastConnections    = "least-connections"
+	RoundRobinAlgorithm         = "round-robin"
+	WeightedRoundRobinAlgorithm = "weighted-round-robin"
+	HashAlgorithm               = "hash"
+	ConsistentHashAlgorithm     = "consistent-hash"
+	LeastConnections            = "least-connections"
+	PowerOfTwoChoices           = "p2c"
+	LeastResponseTime           = "least-response-time"
 )
 
-func NewBalancer(algorithm string, backendURLs []string) (Balancer, error) {
+func NewBalancer(cfg config.Upstream) (Balancer, error) {
 	var err error
 	var balancer Balancer
-	switch algorithm {
-	case HashAlgorithm:
-		balancer, err = NewHashBalancer(backendURLs)
+	switch cfg.Algorithm {
+	case HashAlgorithm, ConsistentHashAlgorithm:
+		balancer, err = newHashBasedBalancer(cfg)
 	case RoundRobinAlgorithm:
-		balancer, err = NewRoundRobinBalancer(backendURLs)
+		balancer, err = NewRoundRobinBalancer(cfg.Backends)
+	case WeightedRoundRobinAlgorithm:
+		balancer, err = NewWeightedRoundRobinBalancer(cfg.Backends, cfg.Weights)
 	case LeastConnections:
-		balancer, err = NewLeastConnectionBalancer(backendURLs)
+		balancer, err = NewLeastConnectionBalancer(cfg.Backends)
+	case PowerOfTwoChoices:
+		balancer, err = NewPowerOfTwoChoicesBalancer(cfg.Backends)
+	case LeastResponseTime:
+		balancer, err = NewLeastResponseTimeBalancer(cfg.Backends)
 	default:
 		err = my_err.ErrUnknownAlgorithm
 	}
@@ -36,5 +48,27 @@ func NewBalancer(algorithm string, backendURLs []string) (Balancer, error) {
 		return nil, err
 	}
 
+	if cfg.Sticky.Enabled {
+		return NewStickyBalancer(balancer, cfg.Sticky.CookieName, cfg.Sticky.Secret, cfg.Sticky.TTL)
+	}
+
 	return balancer, nil
 }
+
+func newHashBasedBalancer(cfg config.Upstream) (Balancer, error) {
+	key, err := NewKeyExtractor(cfg.HashKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := NewHasher(cfg.HashFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Algorithm == ConsistentHashAlgorithm {
+		return NewConsistentHashBalancer(cfg.Backends, cfg.VirtualNodes, key, hasher)
+	}
+
+	return NewHashBalancer(cfg.Backends, key, hasher)
+}
@@ -0,0 +1,106 @@
+package balancer
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/SlashLight/golang-balancer/internal/config"
+)
+
+var testBackends = []string{"http://a:80", "http://b:80", "http://c:80"}
+
+func TestNextSkipsUnavailable(t *testing.T) {
+	algorithms := []string{
+		RoundRobinAlgorithm,
+		WeightedRoundRobinAlgorithm,
+		HashAlgorithm,
+		ConsistentHashAlgorithm,
+		LeastConnections,
+		PowerOfTwoChoices,
+		LeastResponseTime,
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			lb, err := NewBalancer(config.Upstream{Backends: testBackends, Algorithm: algorithm})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// бэкенды выведены из строя, но еще не убраны из балансировщика
+			backends := lb.Backends()
+			backends[0].SetAlive(false)
+			backends[1].SetTripped(true)
+
+			for range 20 {
+				back, err := lb.Next(httptest.NewRequest("GET", "/", nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if back != backends[2] {
+					t.Fatalf("picked unavailable backend %s", back.URL)
+				}
+			}
+
+			backends[2].SetState(StateDraining)
+			if _, err := lb.Next(httptest.NewRequest("GET", "/", nil)); err == nil {
+				t.Error("expected error without available backends")
+			}
+		})
+	}
+}
+
+func TestLeastConnectionsUsesBackendConnections(t *testing.T) {
+	lc, err := NewLeastConnectionBalancer(testBackends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := lc.Backends()
+
+	// без нагрузки запросы расходятся по кругу
+	seen := make(map[*Backend]bool)
+	for range len(backends) {
+		back, _ := lc.Next(nil)
+		seen[back] = true
+	}
+	if len(seen) != len(backends) {
+		t.Errorf("idle picks went to %d of %d backends", len(seen), len(backends))
+	}
+
+	backends[0].IncConnections()
+	backends[2].IncConnections()
+	for range 5 {
+		if back, _ := lc.Next(nil); back != backends[1] {
+			t.Fatalf("picked %s, want least loaded %s", back.URL, backends[1].URL)
+		}
+	}
+}
+
+func TestSyncFollowsLastStateChange(t *testing.T) {
+	lb, err := NewRoundRobinBalancer(testBackends[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := lb.Backends()[0]
+
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			back.SetAlive(i%2 == 0)
+			back.Sync(lb)
+		}()
+		go func() {
+			defer wg.Done()
+			back.SetTripped(i%3 == 0)
+			back.Sync(lb)
+		}()
+	}
+	wg.Wait()
+
+	if inPool := len(lb.Backends()) == 1; inPool != back.Available() {
+		t.Errorf("backend in pool = %v, available = %v", inPool, back.Available())
+	}
+}
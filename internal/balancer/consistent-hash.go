@@ -0,0 +1,136 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const DefaultVirtualNodes = 100
+
+// ConsistentHashBalancer распределяет ключи по кольцу с виртуальными узлами,
+// поэтому при удалении бэкенда переезжают только ключи, которые принадлежали ему
+type ConsistentHashBalancer struct {
+	backends     []*Backend
+	ring         []int
+	owners       map[int]*Backend
+	virtualNodes int
+	key          KeyExtractor
+	hasher       Hasher
+	mu           sync.RWMutex
+}
+
+func NewConsistentHashBalancer(backendsURLs []string, virtualNodes int, key KeyExtractor, hasher Hasher) (*ConsistentHashBalancer, error) {
+	backends, err := GetBackendsFromURLS(backendsURLs)
+	if err != nil {
+		return nil, fmt.Errorf("Error at creating consistent hash balancer: %w", err)
+	}
+
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	if key == nil {
+		key = clientIP
+	}
+	if hasher == nil {
+		hasher = FNVHasher{}
+	}
+
+	chb := &ConsistentHashBalancer{
+		backends:     backends,
+		virtualNodes: virtualNodes,
+		key:          key,
+		hasher:       hasher,
+		mu:           sync.RWMutex{},
+	}
+	chb.rebuildRing()
+
+	return chb, nil
+}
+
+func (chb *ConsistentHashBalancer) Next(r *http.Request) (*Backend, error) {
+	key, err := chb.key(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := chb.hasher.Hash(key)
+
+	chb.mu.RLock()
+	defer chb.mu.RUnlock()
+
+	if len(chb.ring) == 0 {
+		return nil, my_err.ErrNoAliveBackends
+	}
+
+	start := sort.SearchInts(chb.ring, hash)
+	for i := 0; i < len(chb.ring); i++ {
+		back := chb.owners[chb.ring[(start+i)%len(chb.ring)]]
+		if back.Available() {
+			return back, nil
+		}
+	}
+
+	return nil, my_err.ErrNoAliveBackends
+}
+
+func (chb *ConsistentHashBalancer) AddNewBackend(back *Backend) {
+	chb.mu.Lock()
+	defer chb.mu.Unlock()
+
+	for _, existing := range chb.backends {
+		if existing.Index == back.Index {
+			return
+		}
+	}
+
+	chb.backends = append(chb.backends, back)
+	chb.rebuildRing()
+}
+
+func (chb *ConsistentHashBalancer) RemoveBackend(idx int) {
+	chb.mu.Lock()
+	defer chb.mu.Unlock()
+
+	for i, back := range chb.backends {
+		if back.Index == idx {
+			chb.backends = append(chb.backends[:i], chb.backends[i+1:]...)
+			chb.rebuildRing()
+			return
+		}
+	}
+}
+
+// rebuildRing должен вызываться под chb.mu
+func (chb *ConsistentHashBalancer) rebuildRing() {
+	chb.ring = make([]int, 0, len(chb.backends)*chb.virtualNodes)
+	chb.owners = make(map[int]*Backend, len(chb.backends)*chb.virtualNodes)
+
+	for _, back := range chb.backends {
+		for vnode := 0; vnode < chb.virtualNodes; vnode++ {
+			hash := chb.hasher.Hash(back.URL.String() + "#" + strconv.Itoa(vnode))
+			if _, taken := chb.owners[hash]; taken {
+				continue
+			}
+
+			chb.owners[hash] = back
+			chb.ring = append(chb.ring, hash)
+		}
+	}
+
+	sort.Ints(chb.ring)
+}
+
+func (chb *ConsistentHashBalancer) Backends() []*Backend {
+	chb.mu.RLock()
+	defer chb.mu.RUnlock()
+
+	backends := make([]*Backend, len(chb.backends))
+	copy(backends, chb.backends)
+
+	return backends
+}
@@ -0,0 +1,177 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SlashLight/golang-balancer/internal/api"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const (
+	IPHashKey     = "ip"
+	HeaderHashKey = "header"
+	CookieHashKey = "cookie"
+	PathHashKey   = "path"
+	QueryHashKey  = "query"
+)
+
+// KeyExtractor достает из запроса ключ, по которому hash-балансировщики выбирают бэкенд
+type KeyExtractor func(r *http.Request) (string, error)
+
+// NewKeyExtractor разбирает описание ключа из конфига:
+//
+//	ip                  - IP клиента без порта
+//	header:X-User-ID    - значение заголовка
+//	cookie:session      - значение cookie
+//	path:2              - первые N сегментов пути (по умолчанию 1)
+//	query:user          - значение query-параметра
+//	{header:X-User-ID}|{path:1} - шаблон из нескольких частей
+//
+// Если ключ в запросе пустой, используется IP клиента.
+func NewKeyExtractor(spec string) (KeyExtractor, error) {
+	extract, err := parseKeySpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(r *http.Request) (string, error) {
+		key, err := extract(r)
+		if err != nil {
+			return "", err
+		}
+		if key == "" {
+			return clientIP(r)
+		}
+
+		return key, nil
+	}, nil
+}
+
+func parseKeySpec(spec string) (KeyExtractor, error) {
+	if strings.Contains(spec, "{") {
+		return parseKeyTemplate(spec)
+	}
+
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", IPHashKey:
+		return clientIP, nil
+	case HeaderHashKey:
+		if arg == "" {
+			return nil, fmt.Errorf("%w: header name is empty", my_err.ErrInvalidHashKey)
+		}
+		return func(r *http.Request) (string, error) {
+			return r.Header.Get(arg), nil
+		}, nil
+	case CookieHashKey:
+		if arg == "" {
+			return nil, fmt.Errorf("%w: cookie name is empty", my_err.ErrInvalidHashKey)
+		}
+		return func(r *http.Request) (string, error) {
+			cookie, err := r.Cookie(arg)
+			if err != nil {
+				return "", nil
+			}
+			return cookie.Value, nil
+		}, nil
+	case PathHashKey:
+		segments := 1
+		if arg != "" {
+			var err error
+			segments, err = strconv.Atoi(arg)
+			if err != nil || segments < 1 {
+				return nil, fmt.Errorf("%w: bad path segments count %q", my_err.ErrInvalidHashKey, arg)
+			}
+		}
+		return func(r *http.Request) (string, error) {
+			return pathPrefix(r.URL.Path, segments), nil
+		}, nil
+	case QueryHashKey:
+		if arg == "" {
+			return nil, fmt.Errorf("%w: query parameter name is empty", my_err.ErrInvalidHashKey)
+		}
+		return func(r *http.Request) (string, error) {
+			return r.URL.Query().Get(arg), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", my_err.ErrInvalidHashKey, spec)
+	}
+}
+
+// templatePart - литерал или плейсхолдер шаблона ключа
+type templatePart struct {
+	literal string
+	extract KeyExtractor
+}
+
+// parseKeyTemplate разбирает шаблон ключа. Если все плейсхолдеры в запросе пустые, ключ
+// тоже пустой, чтобы использовался IP клиента, а не одни литералы шаблона.
+func parseKeyTemplate(spec string) (KeyExtractor, error) {
+	var parts []templatePart
+	rest := spec
+	for rest != "" {
+		open := strings.Index(rest, "{")
+		if open < 0 {
+			parts = append(parts, templatePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			parts = append(parts, templatePart{literal: rest[:open]})
+		}
+
+		closing := strings.Index(rest[open:], "}")
+		if closing < 0 {
+			return nil, fmt.Errorf("%w: unclosed placeholder in %q", my_err.ErrInvalidHashKey, spec)
+		}
+
+		extract, err := parseKeySpec(rest[open+1 : open+closing])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, templatePart{extract: extract})
+		rest = rest[open+closing+1:]
+	}
+
+	return func(r *http.Request) (string, error) {
+		var key strings.Builder
+		found := false
+		for _, part := range parts {
+			if part.extract == nil {
+				key.WriteString(part.literal)
+				continue
+			}
+
+			value, err := part.extract(r)
+			if err != nil {
+				return "", err
+			}
+			found = found || value != ""
+			key.WriteString(value)
+		}
+		if !found {
+			return "", nil
+		}
+
+		return key.String(), nil
+	}, nil
+}
+
+func clientIP(r *http.Request) (string, error) {
+	if r.RemoteAddr == "" {
+		return "", my_err.ErrNoClientAddr
+	}
+
+	return api.GetIpFromRequest(r)
+}
+
+func pathPrefix(path string, segments int) string {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", segments+1)
+	if len(parts) > segments {
+		parts = parts[:segments]
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
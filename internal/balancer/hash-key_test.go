@@ -0,0 +1,57 @@
+package balancer
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeyTemplateFallsBackToClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:    "placeholder set",
+			spec:    "user-{header:X-User-ID}",
+			headers: map[string]string{"X-User-ID": "42"},
+			want:    "user-42",
+		},
+		{
+			name: "placeholder empty",
+			spec: "user-{header:X-User-ID}",
+			want: "10.0.0.1",
+		},
+		{
+			name:    "one of placeholders set",
+			spec:    "{header:X-Tenant}|{header:X-User-ID}",
+			headers: map[string]string{"X-User-ID": "42"},
+			want:    "|42",
+		},
+		{
+			name: "all placeholders empty",
+			spec: "{header:X-Tenant}|{header:X-User-ID}",
+			want: "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := NewKeyExtractor(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			if got, err := extract(r); err != nil || got != tt.want {
+				t.Errorf("key = %q, err = %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
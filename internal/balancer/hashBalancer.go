@@ -2,7 +2,6 @@ package balancer
 
 import (
 	"fmt"
-	"hash/fnv"
 	"net/http"
 	"sync"
 
@@ -11,47 +10,84 @@ import (
 
 type HashBalancer struct {
 	backends []*Backend
-	hasher   func(string) int // TODO: заменить интерфейсом
+	key      KeyExtractor
+	hasher   Hasher
 	mu       sync.RWMutex
 }
 
-func NewHashBalancer(backendsURLs []string) (*HashBalancer, error) {
+func NewHashBalancer(backendsURLs []string, key KeyExtractor, hasher Hasher) (*HashBalancer, error) {
 	backends, err := GetBackendsFromURLS(backendsURLs)
 	if err != nil {
 		return nil, fmt.Errorf("Error at creating Hash balancer: %w", err)
 	}
 
+	if key == nil {
+		key = clientIP
+	}
+	if hasher == nil {
+		hasher = FNVHasher{}
+	}
+
 	return &HashBalancer{
 		backends: backends,
-		hasher: func(key string) int {
-			h := fnv.New32a()
-			h.Write([]byte(key))
-			return int(h.Sum32())
-		},
-		mu: sync.RWMutex{},
+		key:      key,
+		hasher:   hasher,
+		mu:       sync.RWMutex{},
 	}, nil
 }
 
 func (hb *HashBalancer) Next(r *http.Request) (*Backend, error) {
-	clientIP := r.RemoteAddr
-	if clientIP == "" {
-		return nil, my_err.ErrNoClientAddr
+	key, err := hb.key(r)
+	if err != nil {
+		return nil, err
 	}
 
-	hash := hb.hasher(clientIP)
+	hash := hb.hasher.Hash(key)
 
 	hb.mu.RLock()
 	defer hb.mu.RUnlock()
 
-	index := hash % len(hb.backends)
+	// недоступный бэкенд еще может быть в списке - берем следующий за ним
+	for i := range hb.backends {
+		if back := hb.backends[(hash+i)%len(hb.backends)]; back.Available() {
+			return back, nil
+		}
+	}
 
-	return hb.backends[index], nil
+	return nil, my_err.ErrNoAliveBackends
 }
 
 func (hb *HashBalancer) AddNewBackend(back *Backend) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	for _, existing := range hb.backends {
+		if existing.Index == back.Index {
+			return
+		}
+	}
+
 	hb.backends = append(hb.backends, back)
 }
 
 func (hb *HashBalancer) RemoveBackend(idx int) {
-	hb.backends = append(hb.backends[:idx], hb.backends[idx+1:]...)
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	for i, back := range hb.backends {
+		if back.Index == idx {
+			hb.backends = append(hb.backends[:i], hb.backends[i+1:]...)
+			return
+		}
+	}
+}
+
+func (hb *HashBalancer) Backends() []*Backend {
+	hb.mu.RLock()
+	defer hb.mu.RUnlock()
+
+	backends := make([]*Backend, len(hb.backends))
+	copy(backends, hb.backends)
+
+	return backends
 }
@@ -0,0 +1,42 @@
+package balancer
+
+import (
+	"hash/crc32"
+	"hash/fnv"
+
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const (
+	FNVHashFunction   = "fnv"
+	CRC32HashFunction = "crc32"
+)
+
+type Hasher interface {
+	Hash(key string) int
+}
+
+type FNVHasher struct{}
+
+func (FNVHasher) Hash(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32())
+}
+
+type CRC32Hasher struct{}
+
+func (CRC32Hasher) Hash(key string) int {
+	return int(crc32.ChecksumIEEE([]byte(key)))
+}
+
+func NewHasher(name string) (Hasher, error) {
+	switch name {
+	case "", FNVHashFunction:
+		return FNVHasher{}, nil
+	case CRC32HashFunction:
+		return CRC32Hasher{}, nil
+	default:
+		return nil, my_err.ErrUnknownHashFunction
+	}
+}
@@ -1,46 +1,20 @@
 package balancer
 
 import (
-	"container/heap"
 	"fmt"
 	"net/http"
 	"sync"
-)
-
-type BackendConnections struct {
-	connections uint64
-	Back        *Backend
-}
-
-type BackendHeap []*BackendConnections
-
-func (h BackendHeap) Len() int           { return len(h) }
-func (h BackendHeap) Less(i, j int) bool { return h[i].connections < h[j].connections }
-
-func (h BackendHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
-	h[i].Back.Index = i
-	h[j].Back.Index = j
-}
-
-func (h *BackendHeap) Push(x interface{}) {
-	backend := x.(*BackendConnections)
-	backend.Back.Index = len(*h)
-	*h = append(*h, backend)
-}
 
-func (h *BackendHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	backend := old[n-1]
-	backend.Back.Index = -1
-	*h = old[0 : n-1]
-	return backend
-}
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
 
+// LeastConnectionsBalancer выбирает доступный бэкенд с наименьшим числом запросов в обработке.
+// Запросы считает Backend.Connections, поэтому при равенстве стартовая позиция сдвигается
+// по кругу, чтобы последовательные запросы не уходили на один бэкенд.
 type LeastConnectionsBalancer struct {
-	backends BackendHeap
-	mu       sync.RWMutex
+	backends []*Backend
+	current  int
+	mu       sync.Mutex
 }
 
 func NewLeastConnectionBalancer(backendsURLs []string) (*LeastConnectionsBalancer, error) {
@@ -48,19 +22,10 @@ func NewLeastConnectionBalancer(backendsURLs []string) (*LeastConnectionsBalance
 	if err != nil {
 		return nil, fmt.Errorf("Error at creating Least-connections balancer: %w", err)
 	}
-	backendWithCons := make(BackendHeap, len(backendsURLs))
-	for idx, back := range backends {
-		backendWithCons[idx] = &BackendConnections{
-			connections: 0,
-			Back:        back,
-		}
-	}
-
-	heap.Init(&backendWithCons)
 
 	return &LeastConnectionsBalancer{
-		backends: backendWithCons,
-		mu:       sync.RWMutex{},
+		backends: backends,
+		mu:       sync.Mutex{},
 	}, nil
 }
 
@@ -68,25 +33,53 @@ func (lc *LeastConnectionsBalancer) Next(r *http.Request) (*Backend, error) {
 	lc.mu.Lock()
 	defer lc.mu.Unlock()
 
-	backend := lc.backends[0]
-	backend.connections++
-	heap.Fix(&lc.backends, 0)
+	var best *Backend
+	for i := range lc.backends {
+		back := lc.backends[(lc.current+i)%len(lc.backends)]
+		if back.Available() && (best == nil || back.Connections() < best.Connections()) {
+			best = back
+		}
+	}
+
+	if best == nil {
+		return nil, my_err.ErrNoAliveBackends
+	}
+	lc.current++
 
-	return backend.Back, nil
+	return best, nil
 }
 
-func (lc *LeastConnectionsBalancer) Release(backend *BackendConnections) {
+func (lc *LeastConnectionsBalancer) AddNewBackend(back *Backend) {
 	lc.mu.Lock()
 	defer lc.mu.Unlock()
 
-	backend.connections--
-	heap.Fix(&lc.backends, backend.Back.Index)
-}
+	for _, existing := range lc.backends {
+		if existing.Index == back.Index {
+			return
+		}
+	}
 
-func (lc *LeastConnectionsBalancer) AddNewBackend(back *Backend) {
-	heap.Push(&lc.backends, back)
+	lc.backends = append(lc.backends, back)
 }
 
 func (lc *LeastConnectionsBalancer) RemoveBackend(idx int) {
-	heap.Remove(&lc.backends, idx)
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	for i, back := range lc.backends {
+		if back.Index == idx {
+			lc.backends = append(lc.backends[:i], lc.backends[i+1:]...)
+			return
+		}
+	}
+}
+
+func (lc *LeastConnectionsBalancer) Backends() []*Backend {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	backends := make([]*Backend, len(lc.backends))
+	copy(backends, lc.backends)
+
+	return backends
 }
@@ -0,0 +1,146 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const (
+	ewmaAlpha = 0.3
+	// ewmaHalfLife - за это время без новых замеров оценка задержки уменьшается вдвое,
+	// чтобы бэкенд, который когда-то был медленным, снова получил трафик
+	ewmaHalfLife = 10 * time.Second
+	// failurePenalty засчитывается как задержка неуспешного запроса
+	failurePenalty = time.Second
+)
+
+type latencyStats struct {
+	ewma       float64
+	lastUpdate time.Time
+}
+
+// LeastResponseTimeBalancer выбирает бэкенд с минимальной EWMA задержки,
+// умноженной на число запросов в обработке
+type LeastResponseTimeBalancer struct {
+	backends []*Backend
+	stats    map[string]*latencyStats
+	mu       sync.RWMutex
+}
+
+func NewLeastResponseTimeBalancer(backendsURLs []string) (*LeastResponseTimeBalancer, error) {
+	backends, err := GetBackendsFromURLS(backendsURLs)
+	if err != nil {
+		return nil, fmt.Errorf("Error at creating least-response-time balancer: %w", err)
+	}
+
+	stats := make(map[string]*latencyStats, len(backends))
+	for _, back := range backends {
+		stats[back.URL.String()] = &latencyStats{}
+	}
+
+	return &LeastResponseTimeBalancer{
+		backends: backends,
+		stats:    stats,
+		mu:       sync.RWMutex{},
+	}, nil
+}
+
+func (lrt *LeastResponseTimeBalancer) Next(r *http.Request) (*Backend, error) {
+	lrt.mu.RLock()
+	defer lrt.mu.RUnlock()
+
+	now := time.Now()
+	var best *Backend
+	bestScore := math.Inf(1)
+	for _, back := range lrt.backends {
+		if !back.Available() {
+			continue
+		}
+
+		score := lrt.stats[back.URL.String()].latency(now) * float64(back.Connections()+1)
+		if score < bestScore {
+			best, bestScore = back, score
+		}
+	}
+
+	if best == nil {
+		return nil, my_err.ErrNoAliveBackends
+	}
+
+	return best, nil
+}
+
+func (lrt *LeastResponseTimeBalancer) Observe(back *Backend, latency time.Duration, success bool) {
+	if !success {
+		latency = max(latency, failurePenalty)
+	}
+
+	lrt.mu.Lock()
+	defer lrt.mu.Unlock()
+
+	stats, ok := lrt.stats[back.URL.String()]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	sample := float64(latency)
+	if stats.lastUpdate.IsZero() {
+		stats.ewma = sample
+	} else {
+		stats.ewma = ewmaAlpha*sample + (1-ewmaAlpha)*stats.latency(now)
+	}
+	stats.lastUpdate = now
+}
+
+func (lrt *LeastResponseTimeBalancer) AddNewBackend(back *Backend) {
+	lrt.mu.Lock()
+	defer lrt.mu.Unlock()
+
+	for _, existing := range lrt.backends {
+		if existing.Index == back.Index {
+			return
+		}
+	}
+
+	lrt.backends = append(lrt.backends, back)
+	if _, ok := lrt.stats[back.URL.String()]; !ok {
+		lrt.stats[back.URL.String()] = &latencyStats{}
+	}
+}
+
+func (lrt *LeastResponseTimeBalancer) RemoveBackend(idx int) {
+	lrt.mu.Lock()
+	defer lrt.mu.Unlock()
+
+	for i, back := range lrt.backends {
+		if back.Index == idx {
+			lrt.backends = append(lrt.backends[:i], lrt.backends[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *latencyStats) latency(now time.Time) float64 {
+	if s.lastUpdate.IsZero() {
+		return 0
+	}
+
+	elapsed := now.Sub(s.lastUpdate)
+	return s.ewma * math.Exp2(-float64(elapsed)/float64(ewmaHalfLife))
+}
+
+func (lrt *LeastResponseTimeBalancer) Backends() []*Backend {
+	lrt.mu.RLock()
+	defer lrt.mu.RUnlock()
+
+	backends := make([]*Backend, len(lrt.backends))
+	copy(backends, lrt.backends)
+
+	return backends
+}
@@ -0,0 +1,94 @@
+package balancer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+// PowerOfTwoChoicesBalancer выбирает два случайных живых бэкенда и отдает менее загруженный
+type PowerOfTwoChoicesBalancer struct {
+	backends []*Backend
+	mu       sync.RWMutex
+}
+
+func NewPowerOfTwoChoicesBalancer(backendsURLs []string) (*PowerOfTwoChoicesBalancer, error) {
+	backends, err := GetBackendsFromURLS(backendsURLs)
+	if err != nil {
+		return nil, fmt.Errorf("Error at creating p2c balancer: %w", err)
+	}
+
+	return &PowerOfTwoChoicesBalancer{
+		backends: backends,
+		mu:       sync.RWMutex{},
+	}, nil
+}
+
+func (p *PowerOfTwoChoicesBalancer) Next(r *http.Request) (*Backend, error) {
+	p.mu.RLock()
+	alive := make([]*Backend, 0, len(p.backends))
+	for _, back := range p.backends {
+		if back.Available() {
+			alive = append(alive, back)
+		}
+	}
+	p.mu.RUnlock()
+
+	switch len(alive) {
+	case 0:
+		return nil, my_err.ErrNoAliveBackends
+	case 1:
+		return alive[0], nil
+	}
+
+	first := rand.IntN(len(alive))
+	second := rand.IntN(len(alive) - 1)
+	if second >= first {
+		second++
+	}
+
+	a, b := alive[first], alive[second]
+	if b.Connections() < a.Connections() {
+		return b, nil
+	}
+
+	return a, nil
+}
+
+func (p *PowerOfTwoChoicesBalancer) AddNewBackend(back *Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, existing := range p.backends {
+		if existing.Index == back.Index {
+			return
+		}
+	}
+
+	p.backends = append(p.backends, back)
+}
+
+func (p *PowerOfTwoChoicesBalancer) RemoveBackend(idx int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, back := range p.backends {
+		if back.Index == idx {
+			p.backends = append(p.backends[:i], p.backends[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *PowerOfTwoChoicesBalancer) Backends() []*Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	backends := make([]*Backend, len(p.backends))
+	copy(backends, p.backends)
+
+	return backends
+}
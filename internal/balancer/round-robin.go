@@ -31,12 +31,14 @@ func NewRoundRobinBalancer(backendsURLs []string) (*RoundRobinBalancer, error) {
 func (rr *RoundRobinBalancer) Next(r *http.Request) (*Backend, error) {
 	rr.mu.RLock()
 	defer rr.mu.RUnlock()
-	if len(rr.backends) == 0 {
-		return nil, my_err.ErrNoAliveBackends
+	for range rr.backends {
+		index := atomic.AddUint64(&rr.current, 1) % uint64(len(rr.backends))
+		if back := rr.backends[index]; back.Available() {
+			return back, nil
+		}
 	}
-	index := atomic.AddUint64(&rr.current, 1) % uint64(len(rr.backends))
 
-	return rr.backends[index], nil
+	return nil, my_err.ErrNoAliveBackends
 }
 
 func (rr *RoundRobinBalancer) getAliveBackends() []*Backend {
@@ -53,9 +55,36 @@ func (rr *RoundRobinBalancer) getAliveBackends() []*Backend {
 }
 
 func (rr *RoundRobinBalancer) AddNewBackend(back *Backend) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	for _, existing := range rr.backends {
+		if existing.Index == back.Index {
+			return
+		}
+	}
+
 	rr.backends = append(rr.backends, back)
 }
 
 func (rr *RoundRobinBalancer) RemoveBackend(idx int) {
-	rr.backends = append(rr.backends[:idx], rr.backends[idx+1:]...)
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	for i, back := range rr.backends {
+		if back.Index == idx {
+			rr.backends = append(rr.backends[:i], rr.backends[i+1:]...)
+			return
+		}
+	}
+}
+
+func (rr *RoundRobinBalancer) Backends() []*Backend {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	backends := make([]*Backend, len(rr.backends))
+	copy(backends, rr.backends)
+
+	return backends
 }
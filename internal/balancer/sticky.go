@@ -0,0 +1,147 @@
+package balancer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultStickyCookie = "lb_affinity"
+
+// StickyBalancer закрепляет клиента за бэкендом с помощью подписанной cookie.
+// Пока закрепленный бэкенд доступен, запросы с cookie идут на него, иначе выбор
+// делегируется обернутому балансировщику. Подписи бэкендов считаются при их добавлении,
+// поэтому cookie проверяется одним поиском в map, а не HMAC по каждому бэкенду.
+type StickyBalancer struct {
+	inner      Balancer
+	cookieName string
+	secret     []byte
+	ttl        time.Duration
+	signed     map[string]*Backend
+	mu         sync.RWMutex
+}
+
+// NewStickyBalancer оборачивает inner. Если secret пустой, генерируется случайный ключ,
+// и cookie будут действительны только для текущего процесса.
+func NewStickyBalancer(inner Balancer, cookieName, secret string, ttl time.Duration) (*StickyBalancer, error) {
+	if cookieName == "" {
+		cookieName = DefaultStickyCookie
+	}
+
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	sb := &StickyBalancer{
+		inner:      inner,
+		cookieName: cookieName,
+		secret:     key,
+		ttl:        ttl,
+	}
+	sb.resign()
+
+	return sb, nil
+}
+
+func (sb *StickyBalancer) Next(r *http.Request) (*Backend, error) {
+	if back := sb.pinned(r); back != nil {
+		return back, nil
+	}
+
+	return sb.inner.Next(r)
+}
+
+// SetAffinity добавляет в ответ cookie, закрепляющую клиента за back,
+// если запрос еще не закреплен за ним
+func (sb *StickyBalancer) SetAffinity(w http.ResponseWriter, r *http.Request, back *Backend) {
+	value := sb.sign(back)
+	if cookie, err := r.Cookie(sb.cookieName); err == nil && cookie.Value == value {
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     sb.cookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if sb.ttl > 0 {
+		cookie.MaxAge = int(sb.ttl.Seconds())
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+func (sb *StickyBalancer) AddNewBackend(back *Backend) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	sb.inner.AddNewBackend(back)
+	sb.resign()
+}
+
+func (sb *StickyBalancer) RemoveBackend(idx int) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	sb.inner.RemoveBackend(idx)
+	sb.resign()
+}
+
+// resign пересчитывает подписи бэкендов обернутого балансировщика. Вызывается под sb.mu.
+func (sb *StickyBalancer) resign() {
+	backends := sb.inner.Backends()
+	sb.signed = make(map[string]*Backend, len(backends))
+	for _, back := range backends {
+		sb.signed[sb.sign(back)] = back
+	}
+}
+
+func (sb *StickyBalancer) Backends() []*Backend {
+	return sb.inner.Backends()
+}
+
+// Unwrap возвращает обернутый балансировщик
+func (sb *StickyBalancer) Unwrap() Balancer {
+	return sb.inner
+}
+
+func (sb *StickyBalancer) Observe(back *Backend, latency time.Duration, success bool) {
+	if tracker, ok := sb.inner.(interface {
+		Observe(*Backend, time.Duration, bool)
+	}); ok {
+		tracker.Observe(back, latency, success)
+	}
+}
+
+func (sb *StickyBalancer) pinned(r *http.Request) *Backend {
+	cookie, err := r.Cookie(sb.cookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	sb.mu.RLock()
+	back, ok := sb.signed[cookie.Value]
+	sb.mu.RUnlock()
+	if !ok || !back.Available() {
+		return nil
+	}
+
+	return back
+}
+
+// sign возвращает непрозрачный идентификатор бэкенда, который нельзя подделать без секрета
+func (sb *StickyBalancer) sign(back *Backend) string {
+	mac := hmac.New(sha256.New, sb.secret)
+	mac.Write([]byte(back.URL.String()))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
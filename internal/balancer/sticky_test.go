@@ -0,0 +1,66 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func stickyRequest(t *testing.T, sb *StickyBalancer, back *Backend) *http.Request {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	sb.SetAffinity(rec, httptest.NewRequest("GET", "/", nil), back)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	return req
+}
+
+func TestStickyPinnedPick(t *testing.T) {
+	inner, err := NewLeastConnectionBalancer(testBackends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, err := NewStickyBalancer(inner, "", "secret", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := sb.Backends()
+	pinned := backends[1]
+	req := stickyRequest(t, sb, pinned)
+
+	// закрепленный бэкенд выбирается, даже если он загружен больше остальных
+	pinned.IncConnections()
+	for range 5 {
+		if back, _ := sb.Next(req); back != pinned {
+			t.Fatalf("picked %s, want pinned %s", back.URL, pinned.URL)
+		}
+	}
+	pinned.DecConnections()
+
+	tampered := httptest.NewRequest("GET", "/", nil)
+	tampered.AddCookie(&http.Cookie{Name: DefaultStickyCookie, Value: "0123456789abcdef0123456789abcdef"})
+	if back, _ := sb.Next(tampered); back == nil {
+		t.Fatal("request with unknown cookie got no backend")
+	}
+
+	pinned.SetAlive(false)
+	if back, _ := sb.Next(req); back == pinned {
+		t.Error("picked unavailable pinned backend")
+	}
+	pinned.SetAlive(true)
+
+	sb.RemoveBackend(pinned.Index)
+	if back, _ := sb.Next(req); back == pinned {
+		t.Error("picked backend removed from the pool")
+	}
+	sb.AddNewBackend(pinned)
+	if back, _ := sb.Next(req); back != pinned {
+		t.Error("cookie doesn't pin to the re-added backend")
+	}
+}
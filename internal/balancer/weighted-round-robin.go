@@ -0,0 +1,147 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+// weightedBackend хранит состояние smooth weighted round-robin (как в nginx)
+type weightedBackend struct {
+	back          *Backend
+	weight        int
+	currentWeight int
+}
+
+type WeightedRoundRobinBalancer struct {
+	backends []*weightedBackend
+	weights  map[string]int
+	mu       sync.Mutex
+}
+
+func NewWeightedRoundRobinBalancer(backendsURLs []string, weights map[string]int) (*WeightedRoundRobinBalancer, error) {
+	backends, err := GetBackendsFromURLS(backendsURLs)
+	if err != nil {
+		return nil, fmt.Errorf("Error at creating weighted round-robin balancer: %w", err)
+	}
+
+	wrr := &WeightedRoundRobinBalancer{
+		backends: make([]*weightedBackend, 0, len(backends)),
+		weights:  make(map[string]int, len(backends)),
+		mu:       sync.Mutex{},
+	}
+
+	for _, back := range backends {
+		weight, ok := weights[back.URL.String()]
+		if !ok {
+			weight = DefaultWeight
+		}
+		if weight < 1 {
+			return nil, fmt.Errorf("Error at creating weighted round-robin balancer: %w", my_err.ErrInvalidWeight)
+		}
+
+		back.SetWeight(weight)
+		wrr.weights[back.URL.String()] = weight
+		wrr.backends = append(wrr.backends, &weightedBackend{back: back, weight: weight})
+	}
+
+	return wrr, nil
+}
+
+func (wrr *WeightedRoundRobinBalancer) Next(r *http.Request) (*Backend, error) {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	var best *weightedBackend
+	total := 0
+	for _, wb := range wrr.backends {
+		if !wb.back.Available() {
+			continue
+		}
+
+		wb.currentWeight += wb.weight
+		total += wb.weight
+		if best == nil || wb.currentWeight > best.currentWeight {
+			best = wb
+		}
+	}
+
+	if best == nil {
+		return nil, my_err.ErrNoAliveBackends
+	}
+
+	best.currentWeight -= total
+
+	return best.back, nil
+}
+
+func (wrr *WeightedRoundRobinBalancer) AddNewBackend(back *Backend) {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	for _, wb := range wrr.backends {
+		if wb.back.Index == back.Index {
+			return
+		}
+	}
+
+	weight, ok := wrr.weights[back.URL.String()]
+	if !ok {
+		weight = max(back.GetWeight(), DefaultWeight)
+		wrr.weights[back.URL.String()] = weight
+	}
+
+	back.SetWeight(weight)
+	wrr.backends = append(wrr.backends, &weightedBackend{back: back, weight: weight})
+}
+
+func (wrr *WeightedRoundRobinBalancer) RemoveBackend(idx int) {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	for i, wb := range wrr.backends {
+		if wb.back.Index == idx {
+			wrr.backends = append(wrr.backends[:i], wrr.backends[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetWeight меняет вес бэкенда во время работы. Вес сохраняется, даже если бэкенд
+// временно удален из балансировщика health checker'ом.
+func (wrr *WeightedRoundRobinBalancer) SetWeight(backendURL string, weight int) error {
+	if weight < 1 {
+		return my_err.ErrInvalidWeight
+	}
+
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	if _, ok := wrr.weights[backendURL]; !ok {
+		return my_err.ErrBackendNotFound
+	}
+
+	wrr.weights[backendURL] = weight
+	for _, wb := range wrr.backends {
+		if wb.back.URL.String() == backendURL {
+			wb.weight = weight
+			wb.back.SetWeight(weight)
+		}
+	}
+
+	return nil
+}
+
+func (wrr *WeightedRoundRobinBalancer) Backends() []*Backend {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	backends := make([]*Backend, len(wrr.backends))
+	for i, wb := range wrr.backends {
+		backends[i] = wb.back
+	}
+
+	return backends
+}
@@ -0,0 +1,208 @@
+package circuit_breaker
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+)
+
+type State string
+
+const (
+	// StateClosed - запросы идут на бэкенд, ошибки считаются в скользящем окне
+	StateClosed State = "closed"
+	// StateOpen - бэкенд убран из балансировки до истечения openDuration
+	StateOpen State = "open"
+	// StateHalfOpen - на бэкенд пропускается не больше halfOpenRequests пробных запросов
+	StateHalfOpen State = "half-open"
+)
+
+type Balancer interface {
+	AddNewBackend(*balancer.Backend)
+	RemoveBackend(int)
+}
+
+// TransitionObserver получает каждую смену состояния автомата
+type TransitionObserver interface {
+	ObserveBreakerTransition(from, to string)
+}
+
+type breaker struct {
+	state     State
+	window    window
+	openedAt  time.Time
+	probes    int
+	successes int
+}
+
+// CircuitBreaker хранит автоматы всех бэкендов пула. Разомкнутый бэкенд убирается
+// из балансировщика и возвращается в него в полуоткрытом состоянии.
+type CircuitBreaker struct {
+	cfg      config.CircuitBreaker
+	lb       Balancer
+	breakers map[int]*breaker
+	observer TransitionObserver
+	mu       sync.Mutex
+	log      *slog.Logger
+}
+
+func NewCircuitBreaker(cfg config.CircuitBreaker, lb Balancer, observer TransitionObserver, log *slog.Logger) *CircuitBreaker {
+	return &CircuitBreaker{
+		cfg:      cfg,
+		lb:       lb,
+		breakers: make(map[int]*breaker),
+		observer: observer,
+		log:      log,
+	}
+}
+
+// SetConfig меняет настройки. Накопленная статистика сбрасывается, так как окно могло измениться.
+func (cb *CircuitBreaker) SetConfig(cfg config.CircuitBreaker) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.cfg == cfg {
+		return
+	}
+	cb.cfg = cfg
+	for _, b := range cb.breakers {
+		b.window = window{}
+	}
+}
+
+// Allow сообщает, можно ли отправить запрос на выбранный балансировщиком бэкенд.
+// В полуоткрытом состоянии занимает слот пробного запроса, который освобождается в Report.
+func (cb *CircuitBreaker) Allow(back *balancer.Backend) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !cb.cfg.Enabled {
+		return true
+	}
+
+	b, ok := cb.breakers[back.Index]
+	if !ok {
+		return true
+	}
+
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.probes >= cb.cfg.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+	}
+
+	return true
+}
+
+// Report учитывает результат запроса к бэкенду
+func (cb *CircuitBreaker) Report(back *balancer.Backend, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !cb.cfg.Enabled {
+		return
+	}
+
+	b, ok := cb.breakers[back.Index]
+	if !ok {
+		b = &breaker{state: StateClosed}
+		cb.breakers[back.Index] = b
+	}
+
+	now := time.Now()
+	switch b.state {
+	case StateClosed:
+		b.window.add(now, cb.cfg.Window, !success)
+		total, failures := b.window.totals(now, cb.cfg.Window)
+		if total >= cb.cfg.MinRequests && float64(failures)/float64(total) >= cb.cfg.FailureRatio {
+			cb.open(back, b)
+		}
+	case StateHalfOpen:
+		b.probes = max(0, b.probes-1)
+		if !success {
+			cb.open(back, b)
+			return
+		}
+		b.successes++
+		if b.successes >= cb.cfg.HalfOpenRequests {
+			cb.transition(back, b, StateClosed)
+			b.window = window{}
+		}
+	}
+}
+
+// Release освобождает слот пробного запроса, полученный в Allow, если запрос
+// так и не был отправлен или был отменен
+func (cb *CircuitBreaker) Release(back *balancer.Backend) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if b, ok := cb.breakers[back.Index]; ok && b.state == StateHalfOpen {
+		b.probes = max(0, b.probes-1)
+	}
+}
+
+// State возвращает состояние автомата бэкенда
+func (cb *CircuitBreaker) State(back *balancer.Backend) State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if b, ok := cb.breakers[back.Index]; ok {
+		return b.state
+	}
+
+	return StateClosed
+}
+
+// Forget удаляет автомат бэкенда, убранного из пула
+func (cb *CircuitBreaker) Forget(idx int) {
+	cb.mu.Lock()
+	delete(cb.breakers, idx)
+	cb.mu.Unlock()
+}
+
+func (cb *CircuitBreaker) open(back *balancer.Backend, b *breaker) {
+	cb.transition(back, b, StateOpen)
+	b.openedAt = time.Now()
+	b.probes, b.successes = 0, 0
+
+	back.SetTripped(true)
+	back.Sync(cb.lb)
+
+	openedAt := b.openedAt
+	time.AfterFunc(cb.cfg.OpenDuration, func() { cb.halfOpen(back, openedAt) })
+}
+
+func (cb *CircuitBreaker) halfOpen(back *balancer.Backend, openedAt time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	// автомат успели удалить или разомкнуть заново
+	b, ok := cb.breakers[back.Index]
+	if !ok || b.state != StateOpen || !b.openedAt.Equal(openedAt) {
+		return
+	}
+
+	cb.transition(back, b, StateHalfOpen)
+	back.SetTripped(false)
+	back.Sync(cb.lb)
+}
+
+func (cb *CircuitBreaker) transition(back *balancer.Backend, b *breaker, state State) {
+	cb.log.Info("circuit breaker state changed",
+		slog.String("backend", back.URL.String()),
+		slog.String("from", string(b.state)),
+		slog.String("to", string(state)),
+	)
+	if cb.observer != nil {
+		cb.observer.ObserveBreakerTransition(string(b.state), string(state))
+	}
+	b.state = state
+}
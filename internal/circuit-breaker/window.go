@@ -0,0 +1,47 @@
+package circuit_breaker
+
+import "time"
+
+// windowBuckets - на сколько интервалов делится скользящее окно
+const windowBuckets = 10
+
+type bucket struct {
+	slot     int64
+	total    int
+	failures int
+}
+
+// window считает запросы и ошибки за последние size времени с точностью до size/windowBuckets
+type window struct {
+	buckets [windowBuckets]bucket
+}
+
+func (w *window) add(now time.Time, size time.Duration, failed bool) {
+	slot := slotOf(now, size)
+	b := &w.buckets[slot%windowBuckets]
+	if b.slot != slot {
+		*b = bucket{slot: slot}
+	}
+
+	b.total++
+	if failed {
+		b.failures++
+	}
+}
+
+func (w *window) totals(now time.Time, size time.Duration) (total, failures int) {
+	current := slotOf(now, size)
+	for _, b := range w.buckets {
+		if current-b.slot < windowBuckets {
+			total += b.total
+			failures += b.failures
+		}
+	}
+
+	return total, failures
+}
+
+func slotOf(now time.Time, size time.Duration) int64 {
+	width := max(int64(size/windowBuckets), 1)
+	return now.UnixNano() / width
+}
@@ -1,44 +1,249 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
 )
 
+const DefaultUpstream = "default"
+
 type Config struct {
-	Env           string `yaml:"env" env-default:"local"`
-	Balancer      `yaml:"balancer"`
-	HealthChecker `yaml:"healthChecker"`
-	Redis         `yaml:"redis"`
-	RateLimit     `yaml:"rate-limit"`
+	Env             string `yaml:"env" env-default:"local"`
+	Balancer        `yaml:"balancer"`
+	HealthChecker   `yaml:"healthChecker"`
+	Redis           `yaml:"redis"`
+	RateLimit       `yaml:"rate-limit"`
+	Admin           `yaml:"admin"`
+	Reload          `yaml:"reload"`
+	Forwarding      `yaml:"forwarding"`
+	RequestID       `yaml:"requestID"`
+	Metrics         `yaml:"metrics"`
+	Tracing         `yaml:"tracing"`
+	Upstreams       map[string]Upstream `yaml:"upstreams"`
+	Routes          []Route             `yaml:"routes"`
+	DefaultUpstream string              `yaml:"defaultUpstream"`
 }
 
+// Balancer описывает порт балансировщика и пул бэкендов по умолчанию. Если заданы
+// upstreams, его настройки используются как значения по умолчанию для всех пулов.
 type Balancer struct {
-	Port      int      `yaml:"port" env-required:"true"`
-	Backends  []string `yaml:"backends" env-required:"true"`
-	Retries   int      `yaml:"retries" env-default:"3"`
-	Algorithm string   `yaml:"algorithm" env-required:"true"`
+	Port            int           `yaml:"port" env-required:"true"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env-default:"30s"`
+	ShutdownDelay   time.Duration `yaml:"shutdownDelay" env-default:"0s"`
+	Upstream        `yaml:",inline"`
+}
+
+type Upstream struct {
+	Backends       []string       `yaml:"backends"`
+	Weights        map[string]int `yaml:"weights"`
+	Retries        int            `yaml:"retries" env-default:"3"`
+	Algorithm      string         `yaml:"algorithm" env-default:"round-robin"`
+	VirtualNodes   int            `yaml:"virtualNodes" env-default:"100"`
+	HashKey        string         `yaml:"hashKey" env-default:"ip"`
+	HashFunction   string         `yaml:"hashFunction" env-default:"fnv"`
+	Sticky         Sticky         `yaml:"sticky"`
+	DrainTimeout   time.Duration  `yaml:"drainTimeout" env-default:"30s"`
+	HealthCheck    HealthChecker  `yaml:"healthChecker"`
+	Outlier        Outlier        `yaml:"outlierDetection"`
+	CircuitBreaker CircuitBreaker `yaml:"circuitBreaker"`
+	RetryPolicy    RetryPolicy    `yaml:"retryPolicy"`
+	Hedging        Hedging        `yaml:"hedging"`
+	Transport      Transport      `yaml:"transport"`
+}
+
+// Transport - настройки соединений с бэкендами пула. Protocol: "auto" - HTTP/2 по ALPN для https,
+// "http1" - только HTTP/1.1, "h2c" - HTTP/2 без TLS для http-бэкендов.
+type Transport struct {
+	DialTimeout           time.Duration `yaml:"dialTimeout" env-default:"5s"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tlsHandshakeTimeout" env-default:"5s"`
+	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout" env-default:"30s"`
+	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout" env-default:"90s"`
+	MaxIdleConnsPerHost   int           `yaml:"maxIdleConnsPerHost" env-default:"64"`
+	MaxConnsPerHost       int           `yaml:"maxConnsPerHost" env-default:"0"`
+	KeepAlive             time.Duration `yaml:"keepAlive" env-default:"30s"`
+	DisableKeepAlives     bool          `yaml:"disableKeepAlives"`
+	Protocol              string        `yaml:"protocol" env-default:"auto"`
+	InsecureSkipVerify    bool          `yaml:"insecureSkipVerify"`
+}
+
+// Hedging - дублирование медленных запросов на второй бэкенд. Задержка фиксированная (delay)
+// или перцентиль времени ответа бэкендов пула, если delay не задан.
+type Hedging struct {
+	Enabled       bool          `yaml:"enabled" env-default:"false"`
+	Methods       []string      `yaml:"methods" env-default:"GET"`
+	Paths         []string      `yaml:"paths"`
+	Delay         time.Duration `yaml:"delay" env-default:"0s"`
+	Percentile    int           `yaml:"percentile" env-default:"95"`
+	MinDelay      time.Duration `yaml:"minDelay" env-default:"10ms"`
+	BudgetPercent int           `yaml:"budgetPercent" env-default:"10"`
+}
+
+// RetryPolicy - какие запросы и ошибки повторяются на другом бэкенде. Число попыток задается в retries.
+// Запросы с методами не из methods повторяются, только если в них есть заголовок idempotencyHeader.
+type RetryPolicy struct {
+	Methods           []string      `yaml:"methods" env-default:"GET,HEAD"`
+	Statuses          []string      `yaml:"statuses" env-default:"502,503,504"`
+	Errors            []string      `yaml:"errors" env-default:"dial,reset,timeout"`
+	IdempotencyHeader string        `yaml:"idempotencyHeader" env-default:"Idempotency-Key"`
+	BackoffBase       time.Duration `yaml:"backoffBase" env-default:"25ms"`
+	BackoffMax        time.Duration `yaml:"backoffMax" env-default:"1s"`
+	BudgetPercent     int           `yaml:"budgetPercent" env-default:"20"`
+	BudgetMinRetries  int           `yaml:"budgetMinRetries" env-default:"10"`
+	MaxBufferSize     int64         `yaml:"maxBufferSize" env-default:"1048576"`
+}
+
+// Outlier - пассивная проверка бэкендов по ответам на реальные запросы.
+// Нулевые consecutiveGatewayErrors и slowThreshold отключают соответствующие проверки.
+type Outlier struct {
+	Enabled                  bool          `yaml:"enabled" env-default:"false"`
+	Consecutive5xx           int           `yaml:"consecutive5xx" env-default:"5"`
+	ConsecutiveGatewayErrors int           `yaml:"consecutiveGatewayErrors" env-default:"0"`
+	SlowThreshold            time.Duration `yaml:"slowThreshold" env-default:"0s"`
+	ConsecutiveSlow          int           `yaml:"consecutiveSlow" env-default:"5"`
+	BaseEjectionTime         time.Duration `yaml:"baseEjectionTime" env-default:"30s"`
+	MaxEjectionTime          time.Duration `yaml:"maxEjectionTime" env-default:"5m"`
+	MaxEjectionPercent       int           `yaml:"maxEjectionPercent" env-default:"10"`
+}
+
+// CircuitBreaker - автомат на каждый бэкенд. Размыкается, когда доля ошибок за окно
+// window превышает failureRatio при числе запросов не меньше minRequests.
+type CircuitBreaker struct {
+	Enabled          bool          `yaml:"enabled" env-default:"false"`
+	FailureRatio     float64       `yaml:"failureRatio" env-default:"0.5"`
+	MinRequests      int           `yaml:"minRequests" env-default:"20"`
+	Window           time.Duration `yaml:"window" env-default:"10s"`
+	OpenDuration     time.Duration `yaml:"openDuration" env-default:"30s"`
+	HalfOpenRequests int           `yaml:"halfOpenRequests" env-default:"1"`
+}
+
+type Sticky struct {
+	Enabled    bool          `yaml:"enabled" env-default:"false"`
+	CookieName string        `yaml:"cookieName" env-default:"lb_affinity"`
+	Secret     string        `yaml:"secret"`
+	TTL        time.Duration `yaml:"ttl" env-default:"0s"`
+}
+
+type Route struct {
+	Name       string            `yaml:"name"`
+	Host       string            `yaml:"host"`
+	PathPrefix string            `yaml:"pathPrefix"`
+	PathRegex  string            `yaml:"pathRegex"`
+	Methods    []string          `yaml:"methods"`
+	Headers    map[string]string `yaml:"headers"`
+	Upstream   string            `yaml:"upstream"`
 }
 
 type HealthChecker struct {
-	Interval time.Duration `yaml:"interval" env-default:"10s"`
-	CheckURL string        `yaml:"checkURL" env-required:"true"`
+	Type             string            `yaml:"type" env-default:"http"`
+	Interval         time.Duration     `yaml:"interval" env-default:"10s"`
+	CheckURL         string            `yaml:"checkURL" env-default:"/health"`
+	Timeout          time.Duration     `yaml:"timeout" env-default:"1s"`
+	Rise             int               `yaml:"rise" env-default:"1"`
+	Fall             int               `yaml:"fall" env-default:"1"`
+	Jitter           time.Duration     `yaml:"jitter" env-default:"0s"`
+	Method           string            `yaml:"method" env-default:"GET"`
+	Headers          map[string]string `yaml:"headers"`
+	ExpectedStatuses []string          `yaml:"expectedStatuses"`
+	ExpectedBody     string            `yaml:"expectedBody"`
+	ExpectedJSON     ExpectedJSON      `yaml:"expectedJSON"`
+	Port             int               `yaml:"port"`
+	TLS              ProbeTLS          `yaml:"tls"`
+	GRPCService      string            `yaml:"grpcService"`
+}
+
+// ProbeTLS - настройки TLS для проверок бэкендов по https и grpc
+type ProbeTLS struct {
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+	ServerName         string `yaml:"serverName"`
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+}
+
+type ExpectedJSON struct {
+	Field string `yaml:"field"`
+	Value string `yaml:"value"`
+}
+
+// RequestID - заголовок с идентификатором запроса. Если клиент его не прислал, идентификатор генерируется.
+type RequestID struct {
+	Header string `yaml:"header" env-default:"X-Request-ID"`
+}
+
+// Metrics - путь, по которому отдаются метрики Prometheus. Метрики отдаются на порту admin API,
+// если он включен, иначе на основном порту.
+type Metrics struct {
+	Path string `yaml:"path" env-default:"/metrics"`
+}
+
+// Tracing - экспорт трейсов по OTLP/HTTP. Endpoint - "host:port" или полный URL коллектора.
+type Tracing struct {
+	Enabled     bool          `yaml:"enabled" env-default:"false"`
+	Endpoint    string        `yaml:"endpoint" env-default:"localhost:4318"`
+	Insecure    bool          `yaml:"insecure" env-default:"false"`
+	SampleRatio float64       `yaml:"sampleRatio" env-default:"1"`
+	ServiceName string        `yaml:"serviceName" env-default:"golang-balancer"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+type Admin struct {
+	Port int `yaml:"port" env-default:"0"`
+}
+
+// Reload - настройки перезагрузки конфига. Конфиг всегда перечитывается по SIGHUP,
+// а при WatchInterval > 0 еще и при изменении файла.
+type Reload struct {
+	WatchInterval time.Duration `yaml:"watchInterval" env-default:"0s"`
+}
+
+// Forwarding - заголовки о клиенте, которые передаются бэкендам. Входящие значения этих
+// заголовков сохраняются, только если запрос пришел с адреса из TrustedProxies.
+type Forwarding struct {
+	TrustedProxies []string `yaml:"trustedProxies"`
+	Headers        []string `yaml:"headers" env-default:"x-forwarded-for,x-forwarded-proto,x-forwarded-host,x-real-ip,via"`
+	Via            string   `yaml:"via" env-default:"golang-balancer"`
 }
 
 type Redis struct {
-	Addr         string        `yaml:"addr" env-required:"true"`
+	Addr         string        `yaml:"addr"`
 	DialTimeout  time.Duration `yaml:"dialTimeout" env-default:"5s"`
 	ReadTimeout  time.Duration `yaml:"readTimeout" env-default:"3s"`
 	WriteTimeout time.Duration `yaml:"writeTimeout" env-default:"3s"`
 	Pool         int           `yaml:"pool" env-default:"100"`
 }
 
+// RateLimit - лимиты по умолчанию и хранилище бакетов. Storage: "redis" или "memory" (бакеты в памяти
+// процесса, для одного узла и разработки). При Fallback запросы, которые не удалось проверить в Redis,
+// проверяются лимитером в памяти. Algorithm, DefaultCapacity, DefaultRate и Window - политика для клиентов
+// без индивидуальных настроек, LeaseTimeout - через сколько освобождается слот concurrency-лимита,
+// если узел не завершил запрос (упал или потерял связь с Redis).
 type RateLimit struct {
-	DefaultCapacity int `yaml:"defaultCapacity" env-default:"20"`
-	DefaultRate     int `yaml:"defaultRate" env-default:"2"`
+	Algorithm       string        `yaml:"algorithm" env-default:"token-bucket"`
+	DefaultCapacity int           `yaml:"defaultCapacity" env-default:"20"`
+	DefaultRate     int           `yaml:"defaultRate" env-default:"2"`
+	Window          time.Duration `yaml:"window" env-default:"1s"`
+	LeaseTimeout    time.Duration `yaml:"leaseTimeout" env-default:"1m"`
+	Storage         string        `yaml:"storage" env-default:"redis"`
+	Fallback        bool          `yaml:"fallback" env-default:"false"`
+	Shards          int           `yaml:"shards" env-default:"32"`
+	IdleTTL         time.Duration `yaml:"idleTTL" env-default:"10m"`
+}
+
+// DefaultPolicy - политика для клиентов без индивидуальных настроек
+func (r RateLimit) DefaultPolicy() rate_limiter.Policy {
+	return rate_limiter.Policy{
+		Algorithm: r.Algorithm,
+		Capacity:  r.DefaultCapacity,
+		Rate:      r.DefaultRate,
+		Window:    r.Window,
+	}
 }
 
 func MustLoad() *Config {
@@ -47,15 +252,316 @@ func MustLoad() *Config {
 		log.Fatal("CONFIG_PATH is not set")
 	}
 
+	cfg, err := Load(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return cfg
+}
+
+// Load читает и проверяет конфиг. Используется при старте и при перезагрузке конфига.
+func Load(configPath string) (*Config, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatalf("config file does not exist: %s", configPath)
+		return nil, fmt.Errorf("config file does not exist: %s", configPath)
 	}
 
 	var cfg Config
 
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatalf("cannot read config: %s", err)
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Pools возвращает пулы бэкендов с заполненными значениями по умолчанию.
+// Если upstreams не заданы, единственный пул "default" строится из секции balancer.
+func (c *Config) Pools() map[string]Upstream {
+	if len(c.Upstreams) == 0 {
+		pool := c.Balancer.Upstream
+		pool.HealthCheck = c.HealthChecker
+		return map[string]Upstream{DefaultUpstream: pool}
+	}
+
+	pools := make(map[string]Upstream, len(c.Upstreams))
+	for name, pool := range c.Upstreams {
+		pools[name] = c.withDefaults(pool)
+	}
+
+	return pools
+}
+
+// DefaultPool возвращает имя пула для запросов, не подошедших ни под один маршрут.
+// Пустая строка означает, что на такие запросы отвечаем 404.
+func (c *Config) DefaultPool() string {
+	if len(c.Upstreams) == 0 {
+		return DefaultUpstream
+	}
+
+	return c.DefaultUpstream
+}
+
+func (c *Config) Validate() error {
+	pools := c.Pools()
+	for name, pool := range pools {
+		if len(pool.Backends) == 0 {
+			return fmt.Errorf("upstream %q has no backends", name)
+		}
+	}
+
+	for idx, route := range c.Routes {
+		if _, ok := pools[route.Upstream]; !ok {
+			return fmt.Errorf("route #%d refers to unknown upstream %q", idx, route.Upstream)
+		}
+		if route.PathRegex != "" {
+			if _, err := regexp.Compile(route.PathRegex); err != nil {
+				return fmt.Errorf("route #%d has invalid pathRegex: %w", idx, err)
+			}
+		}
+	}
+
+	if name := c.DefaultPool(); name != "" {
+		if _, ok := pools[name]; !ok {
+			return fmt.Errorf("default upstream %q is not defined", name)
+		}
+	}
+
+	if err := c.RateLimit.DefaultPolicy().Validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Config) withDefaults(pool Upstream) Upstream {
+	defaults := c.Balancer.Upstream
+
+	if pool.Retries == 0 {
+		pool.Retries = defaults.Retries
+	}
+	if pool.Algorithm == "" {
+		pool.Algorithm = defaults.Algorithm
+	}
+	if pool.VirtualNodes == 0 {
+		pool.VirtualNodes = defaults.VirtualNodes
+	}
+	if pool.HashKey == "" {
+		pool.HashKey = defaults.HashKey
+	}
+	if pool.HashFunction == "" {
+		pool.HashFunction = defaults.HashFunction
+	}
+	if pool.Sticky.Enabled && pool.Sticky.CookieName == "" {
+		pool.Sticky.CookieName = defaults.Sticky.CookieName
+	}
+	if pool.DrainTimeout == 0 {
+		pool.DrainTimeout = defaults.DrainTimeout
+	}
+	pool.HealthCheck = c.healthCheckWithDefaults(pool.HealthCheck)
+	pool.Outlier = outlierWithDefaults(pool.Outlier, defaults.Outlier)
+	pool.CircuitBreaker = circuitBreakerWithDefaults(pool.CircuitBreaker, defaults.CircuitBreaker)
+	pool.RetryPolicy = retryPolicyWithDefaults(pool.RetryPolicy, defaults.RetryPolicy)
+	pool.Hedging = hedgingWithDefaults(pool.Hedging, defaults.Hedging)
+	pool.Transport = transportWithDefaults(pool.Transport, defaults.Transport)
+
+	return pool
+}
+
+// outlierWithDefaults наследует секцию целиком, если у пула она не задана,
+// иначе заполняет только пропущенные поля
+func outlierWithDefaults(od, defaults Outlier) Outlier {
+	if od == (Outlier{}) {
+		return defaults
+	}
+
+	if od.Consecutive5xx == 0 {
+		od.Consecutive5xx = defaults.Consecutive5xx
+	}
+	if od.ConsecutiveGatewayErrors == 0 {
+		od.ConsecutiveGatewayErrors = defaults.ConsecutiveGatewayErrors
+	}
+	if od.SlowThreshold == 0 {
+		od.SlowThreshold = defaults.SlowThreshold
+	}
+	if od.ConsecutiveSlow == 0 {
+		od.ConsecutiveSlow = defaults.ConsecutiveSlow
+	}
+	if od.BaseEjectionTime == 0 {
+		od.BaseEjectionTime = defaults.BaseEjectionTime
+	}
+	if od.MaxEjectionTime == 0 {
+		od.MaxEjectionTime = defaults.MaxEjectionTime
+	}
+	if od.MaxEjectionPercent == 0 {
+		od.MaxEjectionPercent = defaults.MaxEjectionPercent
+	}
+
+	return od
+}
+
+func (c *Config) healthCheckWithDefaults(hc HealthChecker) HealthChecker {
+	defaults := c.HealthChecker
+
+	if hc.Type == "" {
+		hc.Type = defaults.Type
+	}
+	if hc.Interval == 0 {
+		hc.Interval = defaults.Interval
+	}
+	if hc.CheckURL == "" {
+		hc.CheckURL = defaults.CheckURL
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = defaults.Timeout
+	}
+	if hc.Rise == 0 {
+		hc.Rise = defaults.Rise
+	}
+	if hc.Fall == 0 {
+		hc.Fall = defaults.Fall
+	}
+	if hc.Jitter == 0 {
+		hc.Jitter = defaults.Jitter
+	}
+	if hc.Method == "" {
+		hc.Method = defaults.Method
+	}
+	if hc.Headers == nil {
+		hc.Headers = defaults.Headers
+	}
+	if hc.ExpectedStatuses == nil {
+		hc.ExpectedStatuses = defaults.ExpectedStatuses
+	}
+	if hc.ExpectedBody == "" && hc.ExpectedJSON.Field == "" {
+		hc.ExpectedBody = defaults.ExpectedBody
+		hc.ExpectedJSON = defaults.ExpectedJSON
+	}
+	if hc.Port == 0 {
+		hc.Port = defaults.Port
+	}
+	if hc.TLS == (ProbeTLS{}) {
+		hc.TLS = defaults.TLS
+	}
+	if hc.GRPCService == "" {
+		hc.GRPCService = defaults.GRPCService
+	}
+
+	return hc
+}
+
+func circuitBreakerWithDefaults(cb, defaults CircuitBreaker) CircuitBreaker {
+	if cb == (CircuitBreaker{}) {
+		return defaults
+	}
+
+	if cb.FailureRatio == 0 {
+		cb.FailureRatio = defaults.FailureRatio
+	}
+	if cb.MinRequests == 0 {
+		cb.MinRequests = defaults.MinRequests
+	}
+	if cb.Window == 0 {
+		cb.Window = defaults.Window
+	}
+	if cb.OpenDuration == 0 {
+		cb.OpenDuration = defaults.OpenDuration
+	}
+	if cb.HalfOpenRequests == 0 {
+		cb.HalfOpenRequests = defaults.HalfOpenRequests
+	}
+
+	return cb
+}
+
+func retryPolicyWithDefaults(rp, defaults RetryPolicy) RetryPolicy {
+	if rp.Methods == nil {
+		rp.Methods = defaults.Methods
+	}
+	if rp.Statuses == nil {
+		rp.Statuses = defaults.Statuses
+	}
+	if rp.Errors == nil {
+		rp.Errors = defaults.Errors
+	}
+	if rp.IdempotencyHeader == "" {
+		rp.IdempotencyHeader = defaults.IdempotencyHeader
+	}
+	if rp.BackoffBase == 0 {
+		rp.BackoffBase = defaults.BackoffBase
+	}
+	if rp.BackoffMax == 0 {
+		rp.BackoffMax = defaults.BackoffMax
+	}
+	if rp.BudgetPercent == 0 {
+		rp.BudgetPercent = defaults.BudgetPercent
+	}
+	if rp.BudgetMinRetries == 0 {
+		rp.BudgetMinRetries = defaults.BudgetMinRetries
+	}
+	if rp.MaxBufferSize == 0 {
+		rp.MaxBufferSize = defaults.MaxBufferSize
+	}
+
+	return rp
+}
+
+func hedgingWithDefaults(h, defaults Hedging) Hedging {
+	if h.Methods == nil {
+		h.Methods = defaults.Methods
+	}
+	if h.Paths == nil {
+		h.Paths = defaults.Paths
+	}
+	if h.Delay == 0 {
+		h.Delay = defaults.Delay
+	}
+	if h.Percentile == 0 {
+		h.Percentile = defaults.Percentile
+	}
+	if h.MinDelay == 0 {
+		h.MinDelay = defaults.MinDelay
+	}
+	if h.BudgetPercent == 0 {
+		h.BudgetPercent = defaults.BudgetPercent
+	}
+
+	return h
+}
+
+func transportWithDefaults(t, defaults Transport) Transport {
+	if t == (Transport{}) {
+		return defaults
+	}
+
+	if t.DialTimeout == 0 {
+		t.DialTimeout = defaults.DialTimeout
+	}
+	if t.TLSHandshakeTimeout == 0 {
+		t.TLSHandshakeTimeout = defaults.TLSHandshakeTimeout
+	}
+	if t.ResponseHeaderTimeout == 0 {
+		t.ResponseHeaderTimeout = defaults.ResponseHeaderTimeout
+	}
+	if t.IdleConnTimeout == 0 {
+		t.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	if t.MaxIdleConnsPerHost == 0 {
+		t.MaxIdleConnsPerHost = defaults.MaxIdleConnsPerHost
+	}
+	if t.MaxConnsPerHost == 0 {
+		t.MaxConnsPerHost = defaults.MaxConnsPerHost
+	}
+	if t.KeepAlive == 0 {
+		t.KeepAlive = defaults.KeepAlive
+	}
+	if t.Protocol == "" {
+		t.Protocol = defaults.Protocol
 	}
 
-	return &cfg
+	return t
 }
@@ -1,72 +1,297 @@
 package health_check
 
 import (
+	"context"
 	"log/slog"
-	"net/http"
-	url2 "net/url"
+	"math/rand/v2"
 	"sync"
 	"time"
 
 	"github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
 )
 
 type Balancer interface {
 	AddNewBackend(*balancer.Backend)
 	RemoveBackend(int)
 }
+
+// ProbeObserver получает результат каждой активной проверки
+type ProbeObserver interface {
+	ObserveProbe(backend string, success bool, d time.Duration)
+}
+
+// BackendHealth - история проверок бэкенда
+type BackendHealth struct {
+	LastCheck            time.Time     `json:"last_check"`
+	LastDuration         time.Duration `json:"last_duration_ns"`
+	LastError            string        `json:"last_error,omitempty"`
+	ConsecutiveSuccesses int           `json:"consecutive_successes"`
+	ConsecutiveFailures  int           `json:"consecutive_failures"`
+}
+
 type HealthChecker struct {
-	interval       time.Duration
-	Backend        []*balancer.Backend
-	HealthCheckURL string
-	mu             sync.RWMutex
-	log            *slog.Logger
+	settings *settings
+	Backend  []*balancer.Backend
+	health   map[int]*BackendHealth
+	// probing - бэкенды, проверка которых еще идет
+	probing  map[int]bool
+	observer ProbeObserver
+	mu       sync.RWMutex
+	log      *slog.Logger
 }
 
-func NewHealthChecker(timer time.Duration, backs []string, checkURL string, log *slog.Logger) (*HealthChecker, error) {
-	backends, err := balancer.GetBackendsFromURLS(backs)
+func NewHealthChecker(cfg config.HealthChecker, backends []*balancer.Backend, observer ProbeObserver, log *slog.Logger) (*HealthChecker, error) {
+	s, err := newSettings(cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	return &HealthChecker{
-		interval:       timer,
-		Backend:        backends,
-		HealthCheckURL: checkURL,
-		mu:             sync.RWMutex{},
-		log:            log,
+		settings: s,
+		Backend:  backends,
+		health:   make(map[int]*BackendHealth, len(backends)),
+		probing:  make(map[int]bool, len(backends)),
+		observer: observer,
+		mu:       sync.RWMutex{},
+		log:      log,
 	}, nil
 }
 
-// TODO: добавить логи
-func (hc *HealthChecker) Start(balancer Balancer) {
-	ticker := time.NewTicker(hc.interval)
-	for range ticker.C {
-		hc.mu.RLock()
-		backends := hc.Backend
-		hc.mu.RUnlock()
-
-		for _, back := range backends {
-			doctor := http.Client{Timeout: time.Second}
-			healthUrl, err := url2.Parse(back.URL.String() + hc.HealthCheckURL)
-			resp, err := doctor.Do(&http.Request{Method: http.MethodGet, URL: healthUrl})
-
-			isAlive := err == nil && resp.StatusCode < 500
-			hc.mu.RLock()
-			if isAlive && !back.Alive {
-				hc.log.Info("backend is now alive", back.URL.String())
-				balancer.AddNewBackend(back)
-
-			} else if !isAlive && back.Alive {
-				hc.log.Info("backend doesnt respond correctly", back.URL.String())
-				balancer.RemoveBackend(back.Index)
+func (hc *HealthChecker) Start(ctx context.Context, lb Balancer) {
+	interval := hc.Interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			closeProbe(hc.current().probe)
+			hc.log.Info("health checker stopped")
+			return
+		case <-ticker.C:
+		}
+
+		if current := hc.Interval(); current != interval {
+			interval = current
+			ticker.Reset(interval)
+		}
+
+		s := hc.current()
+		if s.probe == nil {
+			hc.revive(lb)
+			continue
+		}
+
+		// медленный бэкенд не задерживает проверки остальных: если его прошлая
+		// проверка еще идет, он пропускает этот тик
+		for _, back := range hc.Backends() {
+			if !hc.startProbe(back.Index) {
+				hc.log.Debug("previous probe is still running", slog.String("backend", back.URL.String()))
+				continue
 			}
-			hc.mu.RUnlock()
+			go func() {
+				defer hc.finishProbe(back.Index)
+				hc.checkBackend(ctx, s, back, lb)
+			}()
+		}
+	}
+}
+
+func (hc *HealthChecker) startProbe(idx int) bool {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if hc.probing[idx] {
+		return false
+	}
+	hc.probing[idx] = true
+
+	return true
+}
 
-			if isAlive != back.Alive {
-				hc.mu.Lock()
-				back.SetAlive(isAlive)
-				hc.mu.Unlock()
+// finishProbe снимает отметку о проверке. Если бэкенд удалили, пока шла проверка,
+// его история и ресурсы проверки освобождаются здесь.
+func (hc *HealthChecker) finishProbe(idx int) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	delete(hc.probing, idx)
+	for _, back := range hc.Backend {
+		if back.Index == idx {
+			return
+		}
+	}
+
+	delete(hc.health, idx)
+	if forgetter, ok := hc.settings.probe.(probeForgetter); ok {
+		forgetter.Forget(idx)
+	}
+}
+
+// checkBackend проверяет бэкенд и меняет его состояние, только когда набрано
+// rise успешных или fall неуспешных проверок подряд
+func (hc *HealthChecker) checkBackend(ctx context.Context, s *settings, back *balancer.Backend, lb Balancer) {
+	if s.cfg.Jitter > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rand.N(s.cfg.Jitter)):
+		}
+	}
+
+	start := time.Now()
+	err := s.probe.Check(ctx, back)
+	// результат проверки со старыми настройками отбрасывается: ее соединения могли
+	// закрыться при замене конфига
+	if ctx.Err() != nil || hc.current() != s {
+		return
+	}
+
+	h := hc.record(back, start, err)
+	if hc.observer != nil {
+		hc.observer.ObserveProbe(back.URL.String(), err == nil, h.LastDuration)
+	}
+	wasAlive := back.IsAlive()
+
+	switch {
+	case err == nil && !wasAlive && h.ConsecutiveSuccesses >= s.cfg.Rise:
+		back.SetAlive(true)
+		back.Sync(lb)
+		hc.log.Info("backend is now alive", slog.String("backend", back.URL.String()))
+	case err != nil && wasAlive && h.ConsecutiveFailures >= s.cfg.Fall:
+		back.SetAlive(false)
+		back.Sync(lb)
+		hc.log.Info("backend doesnt respond correctly",
+			slog.String("backend", back.URL.String()),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// revive возвращает бэкенды, убранные активными проверками, когда пул переведен
+// в пассивный режим. Дальше их состояние определяет только outlier detection.
+func (hc *HealthChecker) revive(lb Balancer) {
+	for _, back := range hc.Backends() {
+		if back.IsAlive() {
+			continue
+		}
+
+		back.SetAlive(true)
+		back.Sync(lb)
+		hc.log.Info("backend is alive in passive mode", slog.String("backend", back.URL.String()))
+	}
+}
+
+func (hc *HealthChecker) record(back *balancer.Backend, start time.Time, err error) BackendHealth {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	h, ok := hc.health[back.Index]
+	if !ok {
+		h = &BackendHealth{}
+		hc.health[back.Index] = h
+	}
+
+	h.LastCheck = start
+	h.LastDuration = time.Since(start)
+	if err != nil {
+		h.LastError = err.Error()
+		h.ConsecutiveFailures++
+		h.ConsecutiveSuccesses = 0
+	} else {
+		h.LastError = ""
+		h.ConsecutiveSuccesses++
+		h.ConsecutiveFailures = 0
+	}
+
+	return *h
+}
+
+// Health возвращает историю проверок бэкенда
+func (hc *HealthChecker) Health(back *balancer.Backend) (BackendHealth, bool) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	h, ok := hc.health[back.Index]
+	if !ok {
+		return BackendHealth{}, false
+	}
+
+	return *h, true
+}
+
+func (hc *HealthChecker) Interval() time.Duration {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return hc.settings.cfg.Interval
+}
+
+// SetConfig меняет настройки проверок, они применяются со следующей проверки
+func (hc *HealthChecker) SetConfig(cfg config.HealthChecker) error {
+	s, err := newSettings(cfg)
+	if err != nil {
+		return err
+	}
+
+	hc.mu.Lock()
+	old := hc.settings
+	hc.settings = s
+	hc.mu.Unlock()
+	closeProbe(old.probe)
+
+	return nil
+}
+
+func (hc *HealthChecker) current() *settings {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return hc.settings
+}
+
+func closeProbe(probe Probe) {
+	if closer, ok := probe.(probeCloser); ok {
+		closer.Close()
+	}
+}
+
+// Register добавляет бэкенд в список опрашиваемых
+func (hc *HealthChecker) Register(back *balancer.Backend) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	for _, existing := range hc.Backend {
+		if existing.Index == back.Index {
+			return
+		}
+	}
+
+	hc.Backend = append(hc.Backend, back)
+}
+
+func (hc *HealthChecker) Unregister(idx int) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	for i, back := range hc.Backend {
+		if back.Index == idx {
+			hc.Backend = append(hc.Backend[:i:i], hc.Backend[i+1:]...)
+			delete(hc.health, idx)
+			if forgetter, ok := hc.settings.probe.(probeForgetter); ok {
+				forgetter.Forget(idx)
 			}
+			return
 		}
 	}
 }
+
+// Backends возвращает все бэкенды пула, включая мертвые и отключенные
+func (hc *HealthChecker) Backends() []*balancer.Backend {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	backends := make([]*balancer.Backend, len(hc.Backend))
+	copy(backends, hc.Backend)
+
+	return backends
+}
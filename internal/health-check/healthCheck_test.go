@@ -0,0 +1,90 @@
+package health_check
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+)
+
+// blockingProbe зависает на проверке slow, пока не закроют release, остальные бэкенды
+// отвечают сразу
+type blockingProbe struct {
+	slow    *balancer.Backend
+	release chan struct{}
+	mu      sync.Mutex
+	checks  map[*balancer.Backend]int
+}
+
+func (p *blockingProbe) Check(ctx context.Context, back *balancer.Backend) error {
+	p.mu.Lock()
+	p.checks[back]++
+	p.mu.Unlock()
+
+	if back == p.slow {
+		select {
+		case <-ctx.Done():
+		case <-p.release:
+		}
+	}
+
+	return nil
+}
+
+func (p *blockingProbe) count(back *balancer.Backend) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.checks[back]
+}
+
+func TestSlowProbeDoesntDelayOthers(t *testing.T) {
+	lb, err := balancer.NewRoundRobinBalancer([]string{"http://fast:80", "http://slow:80"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := lb.Backends()
+	fast, slow := backends[0], backends[1]
+
+	hc, err := NewHealthChecker(config.HealthChecker{Interval: 5 * time.Millisecond}, backends, nil, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe := &blockingProbe{slow: slow, release: make(chan struct{}), checks: make(map[*balancer.Backend]int)}
+	hc.settings.probe = probe
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hc.Start(ctx, lb)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for probe.count(fast) < 5 {
+		select {
+		case <-deadline:
+			t.Fatalf("fast backend checked %d times while slow probe hangs", probe.count(fast))
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if got := probe.count(slow); got != 1 {
+		t.Errorf("slow backend checked %d times, want 1 while its probe is running", got)
+	}
+
+	close(probe.release)
+	for probe.count(slow) < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("slow backend isn't checked again after its probe finished")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package health_check
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+// grpcProbe проверяет бэкенд по протоколу grpc.health.v1. Для бэкендов со схемой https
+// соединение устанавливается по TLS. Соединение с бэкендом создается при первой проверке
+// и переиспользуется, пока бэкенд не удален или проверка не заменена.
+type grpcProbe struct {
+	port    int
+	service string
+	timeout time.Duration
+	tls     credentials.TransportCredentials
+	conns   map[int]*grpc.ClientConn
+	closed  bool
+	mu      sync.Mutex
+}
+
+func newGRPCProbe(cfg config.HealthChecker) (*grpcProbe, error) {
+	tlsCfg, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcProbe{
+		port:    cfg.Port,
+		service: cfg.GRPCService,
+		timeout: cfg.Timeout,
+		tls:     credentials.NewTLS(tlsCfg),
+		conns:   make(map[int]*grpc.ClientConn),
+	}, nil
+}
+
+func (p *grpcProbe) Check(ctx context.Context, back *balancer.Backend) error {
+	conn, err := p.conn(back)
+	if err != nil {
+		return err
+	}
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: p.service})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpc health status %s", resp.GetStatus())
+	}
+
+	return nil
+}
+
+func (p *grpcProbe) conn(back *balancer.Backend) (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, my_err.ErrProbeClosed
+	}
+	if conn, ok := p.conns[back.Index]; ok {
+		return conn, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if back.URL.Scheme == "https" {
+		creds = p.tls
+	}
+
+	conn, err := grpc.NewClient(probeAddr(back, p.port), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	p.conns[back.Index] = conn
+
+	return conn, nil
+}
+
+// Forget закрывает соединение с удаленным бэкендом
+func (p *grpcProbe) Forget(idx int) {
+	p.mu.Lock()
+	conn, ok := p.conns[idx]
+	delete(p.conns, idx)
+	p.mu.Unlock()
+
+	if ok {
+		conn.Close()
+	}
+}
+
+// Close закрывает соединения со всеми бэкендами, когда проверка заменена
+func (p *grpcProbe) Close() {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = make(map[int]*grpc.ClientConn)
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
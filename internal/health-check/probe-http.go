@@ -0,0 +1,173 @@
+package health_check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+// maxProbeBody ограничивает размер тела ответа, которое читается для проверки
+const maxProbeBody = 64 << 10
+
+type statusRange struct {
+	from, to int
+}
+
+// httpProbe проверяет бэкенд HTTP-запросом на checkURL
+type httpProbe struct {
+	cfg      config.HealthChecker
+	statuses []statusRange
+	client   *http.Client
+}
+
+func newHTTPProbe(cfg config.HealthChecker) (*httpProbe, error) {
+	statuses, err := parseStatuses(cfg.ExpectedStatuses)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+
+	return &httpProbe{
+		cfg:      cfg,
+		statuses: statuses,
+		client:   &http.Client{Timeout: cfg.Timeout, Transport: transport},
+	}, nil
+}
+
+// parseStatuses разбирает коды ответа вида "200", "200-399". По умолчанию успешен любой код меньше 500.
+func parseStatuses(raw []string) ([]statusRange, error) {
+	if len(raw) == 0 {
+		return []statusRange{{from: 100, to: 499}}, nil
+	}
+
+	statuses := make([]statusRange, 0, len(raw))
+	for _, item := range raw {
+		fromRaw, toRaw, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		if !isRange {
+			toRaw = fromRaw
+		}
+
+		from, err := strconv.Atoi(fromRaw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad status %q", my_err.ErrInvalidHealthCheck, item)
+		}
+		to, err := strconv.Atoi(toRaw)
+		if err != nil || to < from {
+			return nil, fmt.Errorf("%w: bad status %q", my_err.ErrInvalidHealthCheck, item)
+		}
+
+		statuses = append(statuses, statusRange{from: from, to: to})
+	}
+
+	return statuses, nil
+}
+
+// Check возвращает nil, если бэкенд ответил так, как ожидается в конфиге
+func (p *httpProbe) Check(ctx context.Context, back *balancer.Backend) error {
+	target := *back.URL
+	if p.cfg.Type == ProbeHTTPS {
+		target.Scheme = "https"
+	}
+	if p.cfg.Port != 0 {
+		target.Host = probeAddr(back, p.cfg.Port)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.cfg.Method, target.String()+p.cfg.CheckURL, nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range p.cfg.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// дочитываем тело, чтобы соединение вернулось в пул keep-alive
+	defer func() {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxProbeBody))
+		resp.Body.Close()
+	}()
+
+	if !p.statusExpected(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if p.cfg.ExpectedBody == "" && p.cfg.ExpectedJSON.Field == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return err
+	}
+
+	if p.cfg.ExpectedBody != "" && !strings.Contains(string(body), p.cfg.ExpectedBody) {
+		return fmt.Errorf("response body doesn't contain %q", p.cfg.ExpectedBody)
+	}
+
+	if p.cfg.ExpectedJSON.Field != "" {
+		return matchJSONField(body, p.cfg.ExpectedJSON.Field, p.cfg.ExpectedJSON.Value)
+	}
+
+	return nil
+}
+
+// Close закрывает простаивающие соединения, когда проверка заменена
+func (p *httpProbe) Close() {
+	p.client.CloseIdleConnections()
+}
+
+func (p *httpProbe) statusExpected(code int) bool {
+	for _, r := range p.statuses {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchJSONField сравнивает поле JSON-ответа с ожидаемым значением. Вложенные поля
+// указываются через точку, например "checks.db.status".
+func matchJSONField(body []byte, field, expected string) error {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("response body is not JSON: %w", err)
+	}
+
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("JSON field %q not found", field)
+		}
+		if value, ok = object[key]; !ok {
+			return fmt.Errorf("JSON field %q not found", field)
+		}
+	}
+
+	if got := fmt.Sprint(value); got != expected {
+		return fmt.Errorf("JSON field %q is %q, expected %q", field, got, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package health_check
+
+import (
+	"context"
+	"net"
+
+	"github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+)
+
+// tcpProbe считает бэкенд живым, если к нему удалось установить TCP-соединение
+type tcpProbe struct {
+	port   int
+	dialer net.Dialer
+}
+
+func newTCPProbe(cfg config.HealthChecker) *tcpProbe {
+	return &tcpProbe{
+		port:   cfg.Port,
+		dialer: net.Dialer{Timeout: cfg.Timeout},
+	}
+}
+
+func (p *tcpProbe) Check(ctx context.Context, back *balancer.Backend) error {
+	conn, err := p.dialer.DialContext(ctx, "tcp", probeAddr(back, p.port))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
@@ -0,0 +1,138 @@
+package health_check
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const (
+	ProbeHTTP    = "http"
+	ProbeHTTPS   = "https"
+	ProbeTCP     = "tcp"
+	ProbeGRPC    = "grpc"
+	ProbePassive = "passive"
+)
+
+// Probe - один вид активной проверки бэкенда. Check возвращает nil, если бэкенд здоров.
+type Probe interface {
+	Check(ctx context.Context, back *balancer.Backend) error
+}
+
+// probeCloser - проверка, которая держит соединения с бэкендами. Close вызывается, когда
+// проверка заменена новым конфигом или health checker остановлен.
+type probeCloser interface {
+	Close()
+}
+
+// probeForgetter - проверка, которая держит ресурсы на каждый бэкенд. Forget вызывается,
+// когда бэкенд удален из пула.
+type probeForgetter interface {
+	Forget(idx int)
+}
+
+// settings - разобранный конфиг проверок, который подменяется целиком при перезагрузке.
+// probe == nil означает пассивный режим: бэкенды не опрашиваются.
+type settings struct {
+	cfg   config.HealthChecker
+	probe Probe
+}
+
+// ValidateConfig проверяет конфиг health check'а, не создавая HealthChecker
+func ValidateConfig(cfg config.HealthChecker) error {
+	_, err := newSettings(cfg)
+	return err
+}
+
+func newSettings(cfg config.HealthChecker) (*settings, error) {
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("%w: interval must be positive", my_err.ErrInvalidHealthCheck)
+	}
+	if cfg.Rise < 1 {
+		cfg.Rise = 1
+	}
+	if cfg.Fall < 1 {
+		cfg.Fall = 1
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+
+	probe, err := newProbe(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings{
+		cfg:   cfg,
+		probe: probe,
+	}, nil
+}
+
+func newProbe(cfg config.HealthChecker) (Probe, error) {
+	switch cfg.Type {
+	case ProbeHTTP, ProbeHTTPS, "":
+		return newHTTPProbe(cfg)
+	case ProbeTCP:
+		return newTCPProbe(cfg), nil
+	case ProbeGRPC:
+		return newGRPCProbe(cfg)
+	case ProbePassive:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", my_err.ErrInvalidHealthCheck, cfg.Type)
+	}
+}
+
+// probeAddr возвращает host:port бэкенда. Порт из конфига проверки имеет приоритет
+// над портом из URL, без порта используется стандартный для схемы.
+func probeAddr(back *balancer.Backend, port int) string {
+	host := back.URL.Hostname()
+	switch {
+	case port != 0:
+		return net.JoinHostPort(host, strconv.Itoa(port))
+	case back.URL.Port() != "":
+		return back.URL.Host
+	case back.URL.Scheme == "https":
+		return net.JoinHostPort(host, "443")
+	default:
+		return net.JoinHostPort(host, "80")
+	}
+}
+
+func newTLSConfig(cfg config.ProbeTLS) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", my_err.ErrInvalidHealthCheck, err)
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", my_err.ErrInvalidHealthCheck, cfg.CAFile)
+		}
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", my_err.ErrInvalidHealthCheck, err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
@@ -0,0 +1,34 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+
+	request_id "github.com/SlashLight/golang-balancer/internal/request-id"
+)
+
+// ContextHandler добавляет к записям лога идентификатор запроса из контекста,
+// поэтому все сообщения, залогированные через *Context методы, можно связать с запросом
+type ContextHandler struct {
+	slog.Handler
+}
+
+func NewContextHandler(h slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: h}
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := request_id.FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// BackendState - состояние бэкенда на момент сбора метрик
+type BackendState struct {
+	Upstream  string
+	Backend   string
+	Alive     bool
+	Available bool
+	InFlight  int64
+	// Breaker - состояние circuit breaker'а: closed, half-open или open
+	Breaker string
+}
+
+type BackendSource interface {
+	BackendStates() []BackendState
+}
+
+var (
+	backendUpDesc = prometheus.NewDesc(namespace+"_backend_up",
+		"Whether the backend passes health checks.", []string{"upstream", "backend"}, nil)
+	backendAvailableDesc = prometheus.NewDesc(namespace+"_backend_available",
+		"Whether the backend currently receives traffic.", []string{"upstream", "backend"}, nil)
+	backendInFlightDesc = prometheus.NewDesc(namespace+"_backend_in_flight_requests",
+		"Requests currently proxied to the backend.", []string{"upstream", "backend"}, nil)
+	breakerStateDesc = prometheus.NewDesc(namespace+"_circuit_breaker_state",
+		"Circuit breaker state: 0 - closed, 1 - half-open, 2 - open.", []string{"upstream", "backend"}, nil)
+)
+
+// breakerStates - значения balancer_circuit_breaker_state
+var breakerStates = map[string]float64{"closed": 0, "half-open": 1, "open": 2}
+
+// backendCollector читает состояние бэкендов при каждом сборе метрик, поэтому
+// удаленные бэкенды и пулы пропадают из метрик сами
+type backendCollector struct {
+	source BackendSource
+}
+
+// RegisterBackends добавляет в Registry метрики состояния бэкендов
+func RegisterBackends(source BackendSource) error {
+	return Registry.Register(&backendCollector{source: source})
+}
+
+func (c *backendCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- backendUpDesc
+	ch <- backendAvailableDesc
+	ch <- backendInFlightDesc
+	ch <- breakerStateDesc
+}
+
+func (c *backendCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.source.BackendStates() {
+		ch <- prometheus.MustNewConstMetric(backendUpDesc, prometheus.GaugeValue, boolValue(s.Alive), s.Upstream, s.Backend)
+		ch <- prometheus.MustNewConstMetric(backendAvailableDesc, prometheus.GaugeValue, boolValue(s.Available), s.Upstream, s.Backend)
+		ch <- prometheus.MustNewConstMetric(backendInFlightDesc, prometheus.GaugeValue, float64(s.InFlight), s.Upstream, s.Backend)
+		if state, ok := breakerStates[s.Breaker]; ok {
+			ch <- prometheus.MustNewConstMetric(breakerStateDesc, prometheus.GaugeValue, state, s.Upstream, s.Backend)
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
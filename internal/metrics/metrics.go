@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "balancer"
+
+// Registry содержит все метрики балансировщика. В метках нет адресов клиентов и путей
+// запросов: только имена маршрутов и пулов, адреса бэкендов из конфига, методы и коды ответа.
+var Registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Requests handled by the balancer.",
+	}, []string{"route", "upstream", "method", "status"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time to serve a request, including retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "upstream", "method", "status"})
+
+	backendRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_requests_total",
+		Help:      "Attempts to proxy a request to a backend.",
+	}, []string{"upstream", "backend", "method", "status"})
+	backendRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backend_request_duration_seconds",
+		Help:      "Duration of a single attempt to a backend.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream", "backend", "method", "status"})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Retried attempts.",
+	}, []string{"upstream"})
+	hedgesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hedged_requests_total",
+		Help:      "Hedged requests sent to a second backend.",
+	}, []string{"upstream"})
+
+	probesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "health_check_probes_total",
+		Help:      "Active health check probes by result.",
+	}, []string{"upstream", "backend", "result"})
+	probeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "health_check_probe_duration_seconds",
+		Help:      "Duration of active health check probes.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream", "backend"})
+
+	breakerTransitionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_transitions_total",
+		Help:      "Circuit breaker state transitions.",
+	}, []string{"upstream", "from", "to"})
+
+	rateLimitTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_decisions_total",
+		Help:      "Rate limiter decisions: allowed, denied or error.",
+	}, []string{"result"})
+
+	redisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Duration of Redis commands issued by the rate limiter.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command"})
+	redisErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_errors_total",
+		Help:      "Failed Redis commands issued by the rate limiter.",
+	}, []string{"command"})
+)
+
+const (
+	RateLimitAllowed = "allowed"
+	RateLimitDenied  = "denied"
+	RateLimitError   = "error"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal, requestDuration,
+		backendRequestsTotal, backendRequestDuration,
+		retriesTotal, hedgesTotal,
+		probesTotal, probeDuration,
+		breakerTransitionsTotal,
+		rateLimitTotal,
+		redisDuration, redisErrorsTotal,
+	)
+}
+
+// Handler отдает метрики в текстовом формате Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveRequest учитывает запрос, обработанный маршрутом
+func ObserveRequest(route, upstream, method string, status int, d time.Duration) {
+	labels := []string{route, upstream, normalizeMethod(method), strconv.Itoa(status)}
+	requestsTotal.WithLabelValues(labels...).Inc()
+	requestDuration.WithLabelValues(labels...).Observe(d.Seconds())
+}
+
+func ObserveRateLimit(result string) {
+	rateLimitTotal.WithLabelValues(result).Inc()
+}
+
+// ForgetUpstream удаляет серии удаленного пула
+func ForgetUpstream(name string) {
+	labels := prometheus.Labels{"upstream": name}
+	for _, vec := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{requestsTotal, requestDuration, backendRequestsTotal, backendRequestDuration, retriesTotal, hedgesTotal, probesTotal, probeDuration, breakerTransitionsTotal} {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
+// normalizeMethod ограничивает значения метки method стандартными методами
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import "net/http"
+
+// StatusRecorder запоминает код ответа и размер тела, не буферизуя его
+type StatusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w}
+}
+
+func (sr *StatusRecorder) WriteHeader(code int) {
+	if sr.status == 0 && code >= http.StatusOK {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *StatusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.written += int64(n)
+	return n, err
+}
+
+// Flush сбрасывает ответ и через другие обертки, которые поддерживают Unwrap
+func (sr *StatusRecorder) Flush() {
+	_ = http.NewResponseController(sr.ResponseWriter).Flush()
+}
+
+func (sr *StatusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Status возвращает код ответа. 200, если обработчик ничего не записал.
+func (sr *StatusRecorder) Status() int {
+	if sr.status == 0 {
+		return http.StatusOK
+	}
+	return sr.status
+}
+
+// Written возвращает, сколько байт тела отправлено клиенту
+func (sr *StatusRecorder) Written() int64 {
+	return sr.written
+}
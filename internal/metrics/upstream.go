@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Upstream - метрики одного пула
+type Upstream struct {
+	name    string
+	retries prometheus.Counter
+	hedges  prometheus.Counter
+}
+
+func NewUpstream(name string) *Upstream {
+	return &Upstream{
+		name:    name,
+		retries: retriesTotal.WithLabelValues(name),
+		hedges:  hedgesTotal.WithLabelValues(name),
+	}
+}
+
+func (u *Upstream) Name() string {
+	return u.name
+}
+
+// ObserveAttempt учитывает попытку проксирования запроса на бэкенд
+func (u *Upstream) ObserveAttempt(backend, method string, status int, d time.Duration) {
+	labels := []string{u.name, backend, normalizeMethod(method), strconv.Itoa(status)}
+	backendRequestsTotal.WithLabelValues(labels...).Inc()
+	backendRequestDuration.WithLabelValues(labels...).Observe(d.Seconds())
+}
+
+func (u *Upstream) Retry() {
+	u.retries.Inc()
+}
+
+func (u *Upstream) Hedge() {
+	u.hedges.Inc()
+}
+
+// ObserveProbe учитывает активную проверку бэкенда
+func (u *Upstream) ObserveProbe(backend string, success bool, d time.Duration) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	probesTotal.WithLabelValues(u.name, backend, result).Inc()
+	probeDuration.WithLabelValues(u.name, backend).Observe(d.Seconds())
+}
+
+// ObserveBreakerTransition учитывает смену состояния circuit breaker'а бэкенда
+func (u *Upstream) ObserveBreakerTransition(from, to string) {
+	breakerTransitionsTotal.WithLabelValues(u.name, from, to).Inc()
+}
+
+// ForgetBackend удаляет серии бэкенда, убранного из пула
+func (u *Upstream) ForgetBackend(backend string) {
+	labels := prometheus.Labels{"upstream": u.name, "backend": backend}
+	backendRequestsTotal.DeletePartialMatch(labels)
+	backendRequestDuration.DeletePartialMatch(labels)
+	probesTotal.DeletePartialMatch(labels)
+	probeDuration.DeletePartialMatch(labels)
+}
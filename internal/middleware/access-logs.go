@@ -1,12 +1,11 @@
 package middleware
 
 import (
-	"context"
 	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/SlashLight/golang-balancer/internal/metrics"
 )
 
 func AccessLog(log *slog.Logger) func(next http.Handler) http.Handler {
@@ -17,29 +16,27 @@ func AccessLog(log *slog.Logger) func(next http.Handler) http.Handler {
 
 		log.Info("logger middleware enabled")
 
-		requestID := uuid.New().String()
-
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "requestID", requestID)
 			entry := log.With(
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.String("remote_addr", r.RemoteAddr),
 				slog.String("user_agent", r.UserAgent()),
-				slog.String("request_id", requestID),
 			)
-			responseWithCode := NewResponseRecorder(w)
+			// тело не копируется: ответ может быть больше буфера повторов или потоковым
+			responseWithCode := metrics.NewStatusRecorder(w)
 
 			t1 := time.Now()
 			defer func() {
-				entry.Info("request completed",
-					slog.Int("code", responseWithCode.StatusCode),
+				entry.InfoContext(r.Context(), "request completed",
+					slog.Int("code", responseWithCode.Status()),
+					slog.Int64("bytes", responseWithCode.Written()),
 					slog.String("duration", time.Since(t1).String()),
 				)
 
 			}()
 
-			next.ServeHTTP(responseWithCode, r.WithContext(ctx))
+			next.ServeHTTP(responseWithCode, r)
 		}
 
 		return http.HandlerFunc(fn)
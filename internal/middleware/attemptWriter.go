@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// attemptWriter копит ответ попытки, пока запрос еще можно повторить, и отдает его клиенту
+// только после успешного завершения. Ответ больше limit байт (или потоковый) отправляется
+// клиенту сразу, после этого попытка уже не повторяется.
+type attemptWriter struct {
+	w         http.ResponseWriter
+	header    http.Header
+	status    int
+	body      bytes.Buffer
+	limit     int64
+	committed bool
+}
+
+func newAttemptWriter(w http.ResponseWriter, limit int64) *attemptWriter {
+	return &attemptWriter{w: w, header: make(http.Header), limit: limit}
+}
+
+// newPassthroughWriter пишет ответ сразу клиенту. Используется для последней попытки.
+func newPassthroughWriter(w http.ResponseWriter) *attemptWriter {
+	return &attemptWriter{w: w, committed: true}
+}
+
+func (a *attemptWriter) Header() http.Header {
+	if a.committed {
+		return a.w.Header()
+	}
+
+	return a.header
+}
+
+func (a *attemptWriter) WriteHeader(code int) {
+	if a.committed {
+		if a.status == 0 || a.status < http.StatusOK {
+			a.status = code
+		}
+		a.w.WriteHeader(code)
+		return
+	}
+
+	// информационные ответы не буферизуются, клиент получит только итоговый
+	if code < http.StatusOK || a.status != 0 {
+		return
+	}
+
+	a.status = code
+	if a.streaming() {
+		a.commit()
+	}
+}
+
+func (a *attemptWriter) Write(p []byte) (int, error) {
+	if a.status == 0 {
+		a.WriteHeader(http.StatusOK)
+	}
+	if !a.committed && int64(a.body.Len()+len(p)) > a.limit {
+		a.commit()
+	}
+	if a.committed {
+		return a.w.Write(p)
+	}
+
+	return a.body.Write(p)
+}
+
+// Flush нужен ReverseProxy для потоковых ответов. Пока ответ буферизуется, сбрасывать нечего.
+func (a *attemptWriter) Flush() {
+	if a.committed {
+		_ = http.NewResponseController(a.w).Flush()
+	}
+}
+
+// StatusCode возвращает код ответа бэкенда, 200 если бэкенд его не записал
+func (a *attemptWriter) StatusCode() int {
+	if a.status == 0 {
+		return http.StatusOK
+	}
+
+	return a.status
+}
+
+// started сообщает, что клиент уже получил заголовки ответа
+func (a *attemptWriter) started() bool {
+	return a.committed && a.status != 0
+}
+
+// finish отдает клиенту буферизованный ответ успешной попытки
+func (a *attemptWriter) finish() {
+	if !a.committed {
+		if a.status == 0 {
+			a.status = http.StatusOK
+		}
+		a.commit()
+	}
+}
+
+func (a *attemptWriter) commit() {
+	dst := a.w.Header()
+	for name, values := range a.header {
+		dst[name] = values
+	}
+
+	a.committed = true
+	a.w.WriteHeader(a.status)
+	if a.body.Len() > 0 {
+		_, _ = a.w.Write(a.body.Bytes())
+		a.body.Reset()
+	}
+}
+
+// streaming сообщает, что ответ не стоит копить: это поток событий или
+// заранее известно, что тело не поместится в буфер
+func (a *attemptWriter) streaming() bool {
+	if strings.HasPrefix(a.header.Get("Content-Type"), "text/event-stream") {
+		return true
+	}
+
+	length, err := strconv.ParseInt(a.header.Get("Content-Length"), 10, 64)
+	return err == nil && length > a.limit
+}
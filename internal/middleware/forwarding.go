@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/SlashLight/golang-balancer/internal/api"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+// Заголовки, которые можно перечислить в forwarding.headers
+const (
+	HeaderXForwardedFor   = "x-forwarded-for"
+	HeaderXForwardedProto = "x-forwarded-proto"
+	HeaderXForwardedHost  = "x-forwarded-host"
+	HeaderXRealIP         = "x-real-ip"
+	HeaderForwarded       = "forwarded"
+	HeaderVia             = "via"
+)
+
+// Forwarder выставляет заголовки о клиенте в запросе к бэкенду. Значения этих заголовков
+// из входящего запроса сохраняются, только если он пришел от доверенного прокси.
+type Forwarder struct {
+	settings atomic.Pointer[forwardSettings]
+}
+
+type forwardSettings struct {
+	headers map[string]bool
+	via     string
+}
+
+func NewForwarder(cfg config.Forwarding) (*Forwarder, error) {
+	f := &Forwarder{}
+	if err := f.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ValidateForwarding проверяет конфиг, не меняя текущие настройки
+func ValidateForwarding(cfg config.Forwarding) error {
+	_, err := newForwardSettings(cfg)
+	return err
+}
+
+func (f *Forwarder) SetConfig(cfg config.Forwarding) error {
+	s, err := newForwardSettings(cfg)
+	if err != nil {
+		return err
+	}
+
+	f.settings.Store(s)
+	return nil
+}
+
+func newForwardSettings(cfg config.Forwarding) (*forwardSettings, error) {
+	headers := make(map[string]bool, len(cfg.Headers))
+	for _, header := range cfg.Headers {
+		header = strings.ToLower(strings.TrimSpace(header))
+		switch header {
+		case HeaderXForwardedFor, HeaderXForwardedProto, HeaderXForwardedHost, HeaderXRealIP, HeaderForwarded, HeaderVia:
+			headers[header] = true
+		default:
+			return nil, fmt.Errorf("%w: unknown forwarding header %q", my_err.ErrInvalidForwarding, header)
+		}
+	}
+
+	return &forwardSettings{headers: headers, via: cfg.Via}, nil
+}
+
+// Rewrite дополняет запрос к бэкенду. ReverseProxy перед вызовом Rewrite уже удалил
+// из исходящего запроса X-Forwarded-For, X-Forwarded-Host и X-Forwarded-Proto, X-Real-IP
+// и Forwarded удаляются здесь. Каждый заголовок либо выставляется заново, если он включен
+// в конфиге, либо копируется из входящего запроса доверенного прокси.
+func (f *Forwarder) Rewrite(pr *httputil.ProxyRequest) {
+	s := f.settings.Load()
+	in, out := pr.In, pr.Out
+	out.Header.Del("X-Real-IP")
+	out.Header.Del("Forwarded")
+
+	peer, err := api.PeerIP(in)
+	trusted := err == nil && api.IsTrustedProxy(peer)
+
+	proto := "http"
+	if in.TLS != nil {
+		proto = "https"
+	}
+
+	if s.headers[HeaderXForwardedFor] && err == nil {
+		prior := strings.Join(in.Header.Values("X-Forwarded-For"), ", ")
+		if trusted && prior != "" {
+			out.Header.Set("X-Forwarded-For", prior+", "+peer.String())
+		} else {
+			out.Header.Set("X-Forwarded-For", peer.String())
+		}
+	} else if trusted {
+		copyHeader(out, in, "X-Forwarded-For")
+	}
+
+	if s.headers[HeaderXForwardedProto] {
+		out.Header.Set("X-Forwarded-Proto", trustedValue(in, trusted, "X-Forwarded-Proto", proto))
+	} else if trusted {
+		copyHeader(out, in, "X-Forwarded-Proto")
+	}
+
+	if s.headers[HeaderXForwardedHost] {
+		out.Header.Set("X-Forwarded-Host", trustedValue(in, trusted, "X-Forwarded-Host", in.Host))
+	} else if trusted {
+		copyHeader(out, in, "X-Forwarded-Host")
+	}
+
+	if s.headers[HeaderXRealIP] {
+		if client, err := api.ClientIP(in); err == nil {
+			out.Header.Set("X-Real-IP", client.String())
+		}
+	} else if trusted {
+		copyHeader(out, in, "X-Real-IP")
+	}
+
+	if s.headers[HeaderForwarded] && err == nil {
+		element := fmt.Sprintf("for=%s;host=%q;proto=%s", forwardedNode(peer), in.Host, proto)
+		if prior := strings.Join(in.Header.Values("Forwarded"), ", "); trusted && prior != "" {
+			element = prior + ", " + element
+		}
+		out.Header.Set("Forwarded", element)
+	} else if trusted {
+		copyHeader(out, in, "Forwarded")
+	}
+
+	if s.headers[HeaderVia] {
+		element := fmt.Sprintf("%d.%d %s", in.ProtoMajor, in.ProtoMinor, s.via)
+		if prior := strings.Join(in.Header.Values("Via"), ", "); prior != "" {
+			element = prior + ", " + element
+		}
+		out.Header.Set("Via", element)
+	}
+}
+
+func trustedValue(in *http.Request, trusted bool, header, fallback string) string {
+	if value := in.Header.Get(header); trusted && value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func copyHeader(out, in *http.Request, header string) {
+	if values := in.Header.Values(header); len(values) > 0 {
+		out.Header[http.CanonicalHeaderKey(header)] = values
+	}
+}
+
+// forwardedNode форматирует адрес для Forwarded по RFC 7239: IPv6 в кавычках и скобках
+func forwardedNode(addr netip.Addr) string {
+	if addr.Is6() {
+		return fmt.Sprintf("\"[%s]\"", addr)
+	}
+
+	return addr.String()
+}
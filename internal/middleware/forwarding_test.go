@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/netip"
+	"testing"
+
+	"github.com/SlashLight/golang-balancer/internal/api"
+	"github.com/SlashLight/golang-balancer/internal/config"
+)
+
+func TestForwarderRewrite(t *testing.T) {
+	api.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	t.Cleanup(func() { api.SetTrustedProxies(nil) })
+
+	// incoming - значение во входящем запросе, trusted и untrusted - ожидаемые значения,
+	// когда заголовок включен в конфиге, off - когда выключен, а запрос пришел не от
+	// доверенного прокси (от доверенного значение копируется как есть)
+	tests := []struct {
+		header    string
+		incoming  string
+		trusted   string
+		untrusted string
+		off       string
+	}{
+		{
+			header:    HeaderXForwardedFor,
+			incoming:  "198.51.100.7",
+			trusted:   "198.51.100.7, 10.0.0.1",
+			untrusted: "203.0.113.5",
+		},
+		{
+			header:    HeaderXForwardedProto,
+			incoming:  "https",
+			trusted:   "https",
+			untrusted: "http",
+		},
+		{
+			header:    HeaderXForwardedHost,
+			incoming:  "example.org",
+			trusted:   "example.org",
+			untrusted: "balancer.local",
+		},
+		{
+			header:    HeaderXRealIP,
+			incoming:  "198.51.100.7",
+			trusted:   "198.51.100.7",
+			untrusted: "203.0.113.5",
+		},
+		{
+			header:    HeaderForwarded,
+			incoming:  "for=198.51.100.7",
+			trusted:   `for=198.51.100.7, for=10.0.0.1;host="balancer.local";proto=http`,
+			untrusted: `for=203.0.113.5;host="balancer.local";proto=http`,
+		},
+		{
+			// Via не зависит от доверия: цепочка прокси дополняется всегда
+			header:    HeaderVia,
+			incoming:  "1.1 cdn",
+			trusted:   "1.1 cdn, 1.1 balancer",
+			untrusted: "1.1 cdn, 1.1 balancer",
+			off:       "1.1 cdn",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, trusted := range []bool{true, false} {
+			for _, on := range []bool{true, false} {
+				t.Run(fmt.Sprintf("%s/trusted=%v/on=%v", tt.header, trusted, on), func(t *testing.T) {
+					var headers []string
+					if on {
+						headers = []string{tt.header}
+					}
+					f, err := NewForwarder(config.Forwarding{Headers: headers, Via: "balancer"})
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					in := httptest.NewRequest("GET", "http://balancer.local/", nil)
+					in.RemoteAddr = "203.0.113.5:1234"
+					if trusted {
+						in.RemoteAddr = "10.0.0.1:1234"
+					}
+					for _, header := range tests {
+						in.Header.Set(header.header, header.incoming)
+					}
+
+					// как ReverseProxy перед вызовом Rewrite
+					out := in.Clone(in.Context())
+					out.Header.Del("X-Forwarded-For")
+					out.Header.Del("X-Forwarded-Host")
+					out.Header.Del("X-Forwarded-Proto")
+					f.Rewrite(&httputil.ProxyRequest{In: in, Out: out})
+
+					want := tt.off
+					switch {
+					case on && trusted:
+						want = tt.trusted
+					case on:
+						want = tt.untrusted
+					case trusted:
+						want = tt.incoming
+					}
+					if got := out.Header.Get(tt.header); got != want {
+						t.Errorf("%s = %q, want %q", tt.header, got, want)
+					}
+				})
+			}
+		}
+	}
+}
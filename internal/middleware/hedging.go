@@ -0,0 +1,279 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bl "github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const (
+	// latencySamples - сколько последних задержек хранится для расчета перцентиля
+	latencySamples = 512
+	// minLatencySamples - меньше этого числа замеров перцентиль не считается и hedging не работает
+	minLatencySamples = 100
+	// percentileRefresh - перцентиль пересчитывается раз в столько новых замеров
+	percentileRefresh = 64
+)
+
+var errHedgeLost = errors.New("hedged request lost the race")
+
+// Hedger решает, какие запросы дублировать на второй бэкенд и через сколько
+type Hedger struct {
+	cfg       config.Hedging
+	methods   map[string]bool
+	budget    *retryBudget
+	latencies latencyWindow
+}
+
+func NewHedger(cfg config.Hedging) (*Hedger, error) {
+	if cfg.Delay < 0 || cfg.Percentile < 1 || cfg.Percentile > 99 {
+		return nil, fmt.Errorf("%w: hedging needs delay >= 0 and percentile in 1..99", my_err.ErrInvalidRetryPolicy)
+	}
+	if cfg.BudgetPercent < 0 {
+		return nil, fmt.Errorf("%w: hedge budget must not be negative", my_err.ErrInvalidRetryPolicy)
+	}
+
+	methods := make(map[string]bool, len(cfg.Methods))
+	for _, method := range cfg.Methods {
+		methods[strings.ToUpper(strings.TrimSpace(method))] = true
+	}
+
+	return &Hedger{
+		cfg:     cfg,
+		methods: methods,
+		budget:  &retryBudget{ratio: float64(cfg.BudgetPercent) / 100},
+	}, nil
+}
+
+// Config возвращает конфиг, из которого построен Hedger
+func (h *Hedger) Config() config.Hedging {
+	return h.cfg
+}
+
+// Eligible сообщает, можно ли дублировать запрос
+func (h *Hedger) Eligible(r *http.Request) bool {
+	if h == nil || !h.cfg.Enabled || !h.methods[r.Method] {
+		return false
+	}
+	if len(h.cfg.Paths) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(h.cfg.Paths, func(prefix string) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	})
+}
+
+// delay возвращает задержку перед вторым запросом: фиксированную или перцентиль
+// времени до ответа бэкенда. false - замеров пока недостаточно.
+func (h *Hedger) delay() (time.Duration, bool) {
+	if h.cfg.Delay > 0 {
+		return h.cfg.Delay, true
+	}
+
+	p, ok := h.latencies.percentile(h.cfg.Percentile)
+	if !ok {
+		return 0, false
+	}
+
+	return max(p, h.cfg.MinDelay), true
+}
+
+func (h *Hedger) observe(d time.Duration) {
+	if h != nil && h.cfg.Enabled && h.cfg.Delay == 0 {
+		h.latencies.add(d)
+	}
+}
+
+// hedged отправляет запрос на бэкенд и, если тот не ответил за hedger.delay, дублирует его
+// на второй бэкенд. Клиенту уходит ответ того, кто первым вернул заголовки, второй запрос отменяется.
+func (h *retryHandler) hedged(w http.ResponseWriter, r *http.Request, body []byte, canRetry bool) (*attempt, error) {
+	primary, err := nextBackend(h.balancer, h.breakers, r)
+	if err != nil {
+		return nil, err
+	}
+
+	race := &hedgeRace{}
+	defer race.cancelAll()
+	results := make(chan *attempt, 2)
+	h.launch(w, r, body, primary, canRetry, race, results)
+
+	delay, ok := h.hedger.delay()
+	if !ok {
+		return <-results, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case a := <-results:
+		return a, nil
+	case <-timer.C:
+	}
+
+	running := 1
+	if !race.decided() && h.hedger.budget.allowed() {
+		if secondary := h.hedgeBackend(r, primary); secondary != nil {
+			if h.hedger.budget.withdraw() {
+				h.log.InfoContext(r.Context(), "sending hedged request",
+					slog.String("backend", secondary.URL.String()),
+					slog.String("delay", delay.String()),
+				)
+				h.metrics.Hedge()
+				h.launch(w, r, body, secondary, canRetry, race, results)
+				running++
+			} else {
+				h.discard(secondary)
+			}
+		}
+	}
+
+	var result *attempt
+	for ; running > 0; running-- {
+		a := <-results
+		if race.lost(a) {
+			continue
+		}
+		if result == nil || a.err == nil {
+			result = a
+		}
+	}
+
+	return result, nil
+}
+
+func (h *retryHandler) launch(w http.ResponseWriter, r *http.Request, body []byte, backend *bl.Backend, canRetry bool, race *hedgeRace, results chan<- *attempt) {
+	ctx, cancel := context.WithCancel(r.Context())
+	req := r.Clone(ctx)
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	a := &attempt{backend: backend, cancel: cancel}
+	race.add(a)
+	go func() {
+		h.try(w, req, a, canRetry, race)
+		results <- a
+	}()
+}
+
+// hedgeBackend выбирает для дубля бэкенд, отличный от основного
+func (h *retryHandler) hedgeBackend(r *http.Request, primary *bl.Backend) *bl.Backend {
+	backend, err := nextBackend(h.balancer, h.breakers, r, primary)
+	if err != nil {
+		return nil
+	}
+
+	return backend
+}
+
+// discard возвращает circuit breaker'у разрешение для бэкенда, выбранного для дубля,
+// если дубль так и не отправлен
+func (h *retryHandler) discard(backend *bl.Backend) {
+	if h.breakers != nil {
+		h.breakers.Release(backend)
+	}
+}
+
+// hedgeRace выбирает попытку, первой получившую ответ, и отменяет остальные
+type hedgeRace struct {
+	mu       sync.Mutex
+	attempts []*attempt
+	winner   *attempt
+}
+
+func (hr *hedgeRace) add(a *attempt) {
+	hr.mu.Lock()
+	hr.attempts = append(hr.attempts, a)
+	hr.mu.Unlock()
+}
+
+func (hr *hedgeRace) claim(a *attempt) bool {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	if hr.winner != nil {
+		return hr.winner == a
+	}
+
+	hr.winner = a
+	for _, other := range hr.attempts {
+		if other != a {
+			other.cancel()
+		}
+	}
+
+	return true
+}
+
+func (hr *hedgeRace) decided() bool {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	return hr.winner != nil
+}
+
+// lost сообщает, что попытку отменили, потому что другая уже ответила
+func (hr *hedgeRace) lost(a *attempt) bool {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	return hr.winner != nil && hr.winner != a
+}
+
+func (hr *hedgeRace) cancelAll() {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	for _, a := range hr.attempts {
+		a.cancel()
+	}
+}
+
+// latencyWindow хранит последние задержки и кеширует их перцентиль
+type latencyWindow struct {
+	mu       sync.Mutex
+	samples  [latencySamples]time.Duration
+	total    int
+	cached   time.Duration
+	cachedAt int
+}
+
+func (lw *latencyWindow) add(d time.Duration) {
+	lw.mu.Lock()
+	lw.samples[lw.total%latencySamples] = d
+	lw.total++
+	lw.mu.Unlock()
+}
+
+func (lw *latencyWindow) percentile(p int) (time.Duration, bool) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	count := min(lw.total, latencySamples)
+	if count < minLatencySamples {
+		return 0, false
+	}
+	if lw.cached > 0 && lw.total-lw.cachedAt < percentileRefresh {
+		return lw.cached, true
+	}
+
+	sorted := make([]time.Duration, count)
+	copy(sorted, lw.samples[:count])
+	slices.Sort(sorted)
+
+	lw.cached = sorted[min(count*p/100, count-1)]
+	lw.cachedAt = lw.total
+
+	return lw.cached, true
+}
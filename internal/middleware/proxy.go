@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+
+	bl "github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/tracing"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const (
+	ProtocolAuto  = "auto"
+	ProtocolHTTP1 = "http1"
+	ProtocolH2C   = "h2c"
+)
+
+// Proxies хранит по одному ReverseProxy на бэкенд пула. Все они используют общий
+// транспорт, поэтому соединения с бэкендами переиспользуются между запросами.
+type Proxies struct {
+	cfg       config.Transport
+	transport *http.Transport
+	forwarder *Forwarder
+	mu        sync.RWMutex
+	proxies   map[int]*httputil.ReverseProxy
+}
+
+// attemptHooksKey - ключ контекста, через который долгоживущий прокси
+// находит обработчики конкретной попытки
+type attemptHooksKey struct{}
+
+type attemptHooks struct {
+	modifyResponse func(*http.Response) error
+	handleError    func(error)
+}
+
+func NewProxies(cfg config.Transport, forwarder *Forwarder) (*Proxies, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Proxies{
+		cfg:       cfg,
+		transport: transport,
+		forwarder: forwarder,
+		proxies:   make(map[int]*httputil.ReverseProxy),
+	}, nil
+}
+
+func newTransport(cfg config.Transport) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+		Protocols:             new(http.Protocols),
+	}
+
+	switch cfg.Protocol {
+	case ProtocolAuto, "":
+		transport.Protocols.SetHTTP1(true)
+		transport.Protocols.SetHTTP2(true)
+	case ProtocolHTTP1:
+		transport.Protocols.SetHTTP1(true)
+	case ProtocolH2C:
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("%w: unknown protocol %q", my_err.ErrInvalidTransport, cfg.Protocol)
+	}
+
+	return transport, nil
+}
+
+// Config возвращает конфиг, из которого построен транспорт
+func (p *Proxies) Config() config.Transport {
+	return p.cfg
+}
+
+// Get возвращает прокси бэкенда, создавая его при первом обращении
+func (p *Proxies) Get(backend *bl.Backend) *httputil.ReverseProxy {
+	p.mu.RLock()
+	proxy, ok := p.proxies[backend.Index]
+	p.mu.RUnlock()
+	if ok {
+		return proxy
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if proxy, ok = p.proxies[backend.Index]; ok {
+		return proxy
+	}
+
+	target := backend.URL
+	proxy = &httputil.ReverseProxy{Transport: p.transport}
+	proxy.Rewrite = func(pr *httputil.ProxyRequest) {
+		pr.SetURL(target)
+		// как и NewSingleHostReverseProxy, передаем бэкенду исходный Host
+		pr.Out.Host = pr.In.Host
+		if _, ok := pr.Out.Header["User-Agent"]; !ok {
+			pr.Out.Header.Set("User-Agent", "")
+		}
+		p.forwarder.Rewrite(pr)
+		tracing.Inject(pr.Out.Context(), pr.Out.Header)
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if hooks, ok := resp.Request.Context().Value(attemptHooksKey{}).(*attemptHooks); ok {
+			return hooks.modifyResponse(resp)
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if hooks, ok := r.Context().Value(attemptHooksKey{}).(*attemptHooks); ok {
+			hooks.handleError(err)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	p.proxies[backend.Index] = proxy
+
+	return proxy
+}
+
+// Forget удаляет прокси бэкенда, убранного из пула
+func (p *Proxies) Forget(idx int) {
+	p.mu.Lock()
+	delete(p.proxies, idx)
+	p.mu.Unlock()
+}
+
+// Close закрывает простаивающие соединения, когда транспорт пула заменен
+func (p *Proxies) Close() {
+	p.transport.CloseIdleConnections()
+}
+
+func withAttemptHooks(r *http.Request, hooks *attemptHooks) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), attemptHooksKey{}, hooks))
+}
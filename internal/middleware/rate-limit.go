@@ -5,38 +5,64 @@ import (
 	"log/slog"
 	"net/http"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
 	"github.com/SlashLight/golang-balancer/internal/api"
 	resp "github.com/SlashLight/golang-balancer/internal/api/response"
 	"github.com/SlashLight/golang-balancer/internal/logger"
+	"github.com/SlashLight/golang-balancer/internal/metrics"
+	"github.com/SlashLight/golang-balancer/internal/tracing"
 )
 
+// RateLimiter проверяет лимит клиента. Если release не nil, его нужно вызвать после обработки
+// запроса - так concurrency-лимит освобождает слот.
 type RateLimiter interface {
-	Allow(context.Context, string) (bool, error)
+	Allow(ctx context.Context, key string) (allowed bool, release func(), err error)
 }
 
 func RateLimitMiddleware(limiter RateLimiter, log *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracing.Tracer().Start(r.Context(), "rate limit")
+
 			userIP, err := api.GetIpFromRequest(r)
 			if err != nil {
-				log.Error("Error trying to get IP addr", logger.Err(err))
+				metrics.ObserveRateLimit(metrics.RateLimitError)
+				span.SetStatus(codes.Error, err.Error())
+				span.End()
+				log.ErrorContext(r.Context(), "Error trying to get IP addr", logger.Err(err))
 				resp.RespondError(w, http.StatusInternalServerError, "Internal error", log)
 				return
 			}
 
-			allowed, err := limiter.Allow(r.Context(), userIP)
+			allowed, release, err := limiter.Allow(ctx, userIP)
 			if err != nil {
-				log.Error("Error trying to get rate limits for user", logger.Err(err))
+				metrics.ObserveRateLimit(metrics.RateLimitError)
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				span.End()
+				log.ErrorContext(r.Context(), "Error trying to get rate limits for user", logger.Err(err))
 				resp.RespondError(w, http.StatusInternalServerError, "Internal error", log)
 				return
 			}
 
 			if !allowed {
-				log.Info("User reached the limit", userIP)
+				metrics.ObserveRateLimit(metrics.RateLimitDenied)
+				span.SetAttributes(attribute.String("balancer.rate_limit", metrics.RateLimitDenied))
+				span.End()
+				log.InfoContext(r.Context(), "User reached the limit", slog.String("ip", userIP))
 				resp.RespondError(w, http.StatusTooManyRequests, "Rate limit exceeded", log)
 				return
 			}
 
+			metrics.ObserveRateLimit(metrics.RateLimitAllowed)
+			span.SetAttributes(attribute.String("balancer.rate_limit", metrics.RateLimitAllowed))
+			span.End()
+
+			if release != nil {
+				defer release()
+			}
 			next.ServeHTTP(w, r)
 		}
 
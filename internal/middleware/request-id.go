@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/SlashLight/golang-balancer/internal/config"
+	request_id "github.com/SlashLight/golang-balancer/internal/request-id"
+	"github.com/google/uuid"
+)
+
+// maxRequestIDLength - более длинные входящие идентификаторы заменяются сгенерированными
+const maxRequestIDLength = 128
+
+// RequestID берет идентификатор из заголовка запроса или генерирует новый, кладет его в контекст,
+// передает бэкенду и возвращает клиенту в том же заголовке
+func RequestID(cfg config.RequestID) func(next http.Handler) http.Handler {
+	header := cfg.Header
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !validRequestID(id) {
+				id = uuid.New().String()
+				r.Header.Set(header, id)
+			}
+			w.Header().Set(header, id)
+
+			next.ServeHTTP(w, r.WithContext(request_id.WithID(r.Context(), id)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+// Классы ошибок транспорта, которые можно указать в retryPolicy.errors
+const (
+	ErrorDial    = "dial"
+	ErrorReset   = "reset"
+	ErrorTimeout = "timeout"
+)
+
+// budgetWindow - за какой период считается доля повторных запросов
+const budgetWindow = 10 * time.Second
+
+type statusRange struct {
+	from, to int
+}
+
+// RetryPolicy - разобранный config.RetryPolicy вместе с бюджетом повторов пула
+type RetryPolicy struct {
+	cfg      config.RetryPolicy
+	methods  map[string]bool
+	statuses []statusRange
+	errors   map[string]bool
+	budget   *retryBudget
+}
+
+func NewRetryPolicy(cfg config.RetryPolicy) (*RetryPolicy, error) {
+	methods := make(map[string]bool, len(cfg.Methods))
+	for _, method := range cfg.Methods {
+		methods[strings.ToUpper(strings.TrimSpace(method))] = true
+	}
+
+	statuses := make([]statusRange, 0, len(cfg.Statuses))
+	for _, item := range cfg.Statuses {
+		fromRaw, toRaw, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		if !isRange {
+			toRaw = fromRaw
+		}
+
+		from, err := strconv.Atoi(fromRaw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad status %q", my_err.ErrInvalidRetryPolicy, item)
+		}
+		to, err := strconv.Atoi(toRaw)
+		if err != nil || to < from {
+			return nil, fmt.Errorf("%w: bad status %q", my_err.ErrInvalidRetryPolicy, item)
+		}
+
+		statuses = append(statuses, statusRange{from: from, to: to})
+	}
+
+	classes := make(map[string]bool, len(cfg.Errors))
+	for _, class := range cfg.Errors {
+		class = strings.TrimSpace(class)
+		switch class {
+		case ErrorDial, ErrorReset, ErrorTimeout:
+			classes[class] = true
+		default:
+			return nil, fmt.Errorf("%w: unknown error class %q", my_err.ErrInvalidRetryPolicy, class)
+		}
+	}
+
+	if cfg.BudgetPercent < 0 || cfg.BudgetMinRetries < 0 {
+		return nil, fmt.Errorf("%w: retry budget must not be negative", my_err.ErrInvalidRetryPolicy)
+	}
+
+	return &RetryPolicy{
+		cfg:      cfg,
+		methods:  methods,
+		statuses: statuses,
+		errors:   classes,
+		budget:   &retryBudget{ratio: float64(cfg.BudgetPercent) / 100, minRetries: cfg.BudgetMinRetries},
+	}, nil
+}
+
+// Config возвращает конфиг, из которого построена политика
+func (p *RetryPolicy) Config() config.RetryPolicy {
+	return p.cfg
+}
+
+// Retryable сообщает, можно ли повторять запрос. Неидемпотентные запросы
+// повторяются только с ключом идемпотентности.
+func (p *RetryPolicy) Retryable(r *http.Request) bool {
+	if p.methods[r.Method] {
+		return true
+	}
+
+	return p.cfg.IdempotencyHeader != "" && r.Header.Get(p.cfg.IdempotencyHeader) != ""
+}
+
+func (p *RetryPolicy) retryableStatus(code int) bool {
+	for _, r := range p.statuses {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *RetryPolicy) retryableError(err error) bool {
+	return p.errors[classifyError(err)]
+}
+
+// backoff ждет перед повторной попыткой случайное время до base*2^(attempt-1), но не больше max.
+// Возвращает false, если клиент ушел, не дождавшись.
+func (p *RetryPolicy) backoff(ctx context.Context, attempt int) bool {
+	if p.cfg.BackoffBase <= 0 {
+		return ctx.Err() == nil
+	}
+
+	limit := p.cfg.BackoffBase
+	for i := 1; i < attempt && (p.cfg.BackoffMax <= 0 || limit < p.cfg.BackoffMax); i++ {
+		limit *= 2
+	}
+	if p.cfg.BackoffMax > 0 {
+		limit = min(limit, p.cfg.BackoffMax)
+	}
+
+	timer := time.NewTimer(rand.N(limit) + 1)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// classifyError относит ошибку транспорта к одному из классов retryPolicy.errors
+func classifyError(err error) string {
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ErrorDial
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorReset
+	default:
+		return ""
+	}
+}
+
+// retryBudget ограничивает долю повторов от всех запросов пула, чтобы при падении
+// бэкендов повторы не умножали нагрузку. minRetries повторов за окно разрешены всегда.
+type retryBudget struct {
+	ratio      float64
+	minRetries int
+	mu         sync.Mutex
+	start      time.Time
+	requests   int
+	retries    int
+}
+
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate()
+	b.requests++
+}
+
+func (b *retryBudget) allowed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate()
+	return b.retries < max(b.minRetries, int(b.ratio*float64(b.requests)))
+}
+
+// withdraw учитывает повтор, если он укладывается в бюджет
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate()
+	if b.retries >= max(b.minRetries, int(b.ratio*float64(b.requests))) {
+		return false
+	}
+	b.retries++
+
+	return true
+}
+
+func (b *retryBudget) rotate() {
+	if now := time.Now(); now.Sub(b.start) >= budgetWindow {
+		b.start = now
+		b.requests, b.retries = 0, 0
+	}
+}
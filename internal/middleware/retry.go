@@ -2,86 +2,345 @@ package middleware
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httputil"
-	"strings"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/SlashLight/golang-balancer/internal/api/response"
 	bl "github.com/SlashLight/golang-balancer/internal/balancer"
 	"github.com/SlashLight/golang-balancer/internal/logger"
+	"github.com/SlashLight/golang-balancer/internal/metrics"
+	"github.com/SlashLight/golang-balancer/internal/tracing"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
 )
 
 type Balancer interface {
 	Next(r *http.Request) (*bl.Backend, error)
-	RemoveBackend(int)
+	Backends() []*bl.Backend
+}
+
+// OutlierReporter получает результат каждой попытки для пассивной проверки бэкендов
+type OutlierReporter interface {
+	Report(backend *bl.Backend, statusCode int, latency time.Duration)
+}
+
+// AffinityKeeper закрепляет клиента за выбранным бэкендом (например, через cookie)
+type AffinityKeeper interface {
+	SetAffinity(w http.ResponseWriter, r *http.Request, backend *bl.Backend)
+}
+
+// ResultTracker получает время и исход каждой попытки проксирования
+type ResultTracker interface {
+	Observe(backend *bl.Backend, latency time.Duration, success bool)
+}
+
+// CircuitBreaker не пропускает запросы на бэкенды с разомкнутым автоматом.
+// Release освобождает разрешение, полученное в Allow, не учитывая результат.
+type CircuitBreaker interface {
+	Allow(backend *bl.Backend) bool
+	Report(backend *bl.Backend, success bool)
+	Release(backend *bl.Backend)
+}
+
+// statusError - ответ бэкенда с кодом из retryPolicy.statuses, который не отдается клиенту,
+// потому что запрос будет повторен
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("retryable status %d", e.code)
+}
+
+type retryHandler struct {
+	balancer   Balancer
+	proxies    *Proxies
+	outliers   OutlierReporter
+	breakers   CircuitBreaker
+	policy     *RetryPolicy
+	hedger     *Hedger
+	metrics    *metrics.Upstream
+	log        *slog.Logger
+	maxRetries int
 }
 
-type ConnectionTracker interface {
-	Release(*bl.Backend)
+// attempt - одна попытка проксирования запроса на бэкенд
+type attempt struct {
+	backend *bl.Backend
+	writer  *attemptWriter
+	err     error
+	cancel  context.CancelFunc
 }
 
-var AllowedMethods = map[string]bool{
-	http.MethodGet:  true,
-	http.MethodHead: true,
+// NewRetryHandler проксирует запрос на бэкенды пула с повторами и hedging'ом.
+// Это конечный обработчик цепочки: ответ всегда отдает бэкенд или сам обработчик.
+func NewRetryHandler(balancer Balancer, proxies *Proxies, outliers OutlierReporter, breakers CircuitBreaker, policy *RetryPolicy, hedger *Hedger, m *metrics.Upstream, log *slog.Logger, maxRetries int) http.Handler {
+	return &retryHandler{
+		balancer:   balancer,
+		proxies:    proxies,
+		outliers:   outliers,
+		breakers:   breakers,
+		policy:     policy,
+		hedger:     hedger,
+		metrics:    m,
+		log:        log,
+		maxRetries: maxRetries,
+	}
 }
 
-func RetryMiddleware(balancer Balancer, log *slog.Logger, maxRetries int) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		fn := func(w http.ResponseWriter, r *http.Request) {
-			if !AllowedMethods[r.Method] {
-				next.ServeHTTP(w, r)
+func (h *retryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	attempts := 1
+	retryable := h.policy.Retryable(r)
+	if retryable {
+		attempts = max(h.maxRetries, 1)
+	}
+	hedge := retryable && h.hedger.Eligible(r)
+
+	var body []byte
+	var err error
+	if (attempts > 1 || hedge) && r.Body != nil {
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			h.log.ErrorContext(r.Context(), "error at reading request body", logger.Err(err))
+			response.RespondError(w, http.StatusBadRequest, "Couldn't read request body", h.log)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	h.policy.budget.request()
+	if hedge {
+		h.hedger.budget.request()
+	}
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if !h.policy.budget.withdraw() {
+				h.log.WarnContext(r.Context(), "retry budget exhausted")
+				break
+			}
+			if !h.policy.backoff(r.Context(), i) {
 				return
 			}
+			h.metrics.Retry()
+		}
+
+		// на последней попытке ответ бэкенда отдается клиенту как есть
+		canRetry := i+1 < attempts && h.policy.budget.allowed()
+
+		var a *attempt
+		if hedge {
+			a, err = h.hedged(w, r, body, canRetry)
+		} else {
+			a, err = h.single(w, r, body, canRetry)
+		}
+		if err != nil {
+			h.log.ErrorContext(r.Context(), "error at getting next alive backend server", logger.Err(err))
+			response.RespondError(w, http.StatusServiceUnavailable, "Service unavailable. Try again later", h.log)
+			return
+		}
+
+		if a.err == nil {
+			a.writer.finish()
+			return
+		}
+		// часть ответа уже у клиента, повторять нельзя - обрываем соединение
+		if a.writer.started() {
+			panic(http.ErrAbortHandler)
+		}
+		if r.Context().Err() != nil {
+			h.log.InfoContext(r.Context(), "client cancelled request", slog.String("backend", a.backend.URL.String()))
+			return
+		}
+
+		lastErr = a.err
+		h.log.ErrorContext(r.Context(), "Failed to connect to backend server",
+			slog.String("backend", a.backend.URL.String()),
+			logger.Err(a.err),
+		)
+
+		var se *statusError
+		if !errors.As(a.err, &se) && !h.policy.retryableError(a.err) {
+			break
+		}
+	}
+
+	status := errorStatus(lastErr)
+	h.log.ErrorContext(r.Context(), "Couldn't connect to any server after retries", slog.Int("status", status))
+	response.RespondError(w, status, http.StatusText(status), h.log)
+}
 
-			var body []byte
-			var err error
-			if r.Body != nil {
-				body, err = io.ReadAll(r.Body)
-				if err != nil {
-					log.Error("error at reading request body", logger.Err(err))
-					return
-				}
-				defer r.Body.Close()
+func (h *retryHandler) single(w http.ResponseWriter, r *http.Request, body []byte, canRetry bool) (*attempt, error) {
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	backend, err := nextBackend(h.balancer, h.breakers, r)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &attempt{backend: backend}
+	h.try(w, r, a, canRetry, nil)
+
+	return a, nil
+}
+
+// try проксирует запрос на a.backend и сообщает результат балансировщику,
+// outlier detection и circuit breaker'у. Проигравшие гонку hedge-попытки не учитываются.
+func (h *retryHandler) try(w http.ResponseWriter, r *http.Request, a *attempt, canRetry bool, race *hedgeRace) {
+	backend := a.backend
+	a.writer = newPassthroughWriter(w)
+	if canRetry || race != nil {
+		a.writer = newAttemptWriter(w, h.policy.cfg.MaxBufferSize)
+	}
+
+	ctx, span := tracing.Tracer().Start(r.Context(), "backend attempt",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("balancer.backend", backend.URL.String()),
+			attribute.Bool("balancer.hedged", race != nil),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	r = withAttemptHooks(r.WithContext(ctx), &attemptHooks{
+		modifyResponse: func(resp *http.Response) error {
+			if canRetry && h.policy.retryableStatus(resp.StatusCode) {
+				return &statusError{code: resp.StatusCode}
 			}
+			if race != nil && !race.claim(a) {
+				return errHedgeLost
+			}
+			h.hedger.observe(time.Since(start))
+			return nil
+		},
+		handleError: func(err error) {
+			a.err = err
+		},
+	})
+
+	if keeper, ok := h.balancer.(AffinityKeeper); ok {
+		keeper.SetAffinity(a.writer, r, backend)
+	}
+	h.log.InfoContext(r.Context(), "Trying to connect to backend server", slog.String("backend", backend.URL.String())) //TODO подумать над уровнями логирования
+
+	backend.IncConnections()
+	aborted := serveAttempt(h.proxies.Get(backend), a.writer, r)
+	latency := time.Since(start)
+	backend.DecConnections()
+
+	if aborted && a.err == nil {
+		a.err = errResponseAborted
+	}
+	if race != nil && race.lost(a) {
+		span.SetAttributes(attribute.Bool("balancer.hedge_lost", true))
+		if h.breakers != nil {
+			h.breakers.Release(backend)
+		}
+		return
+	}
 
-			for attempt := 0; attempt < maxRetries; attempt++ {
-				if body != nil {
-					r.Body = io.NopCloser(bytes.NewReader(body))
-				}
-
-				backend, err := balancer.Next(r)
-				if err != nil {
-					log.Error("error at getting next alive backend server", logger.Err(err))
-					response.RespondError(w, http.StatusServiceUnavailable, "Service unavailable. Try again later", log)
-					return
-				}
-
-				proxy := httputil.NewSingleHostReverseProxy(backend.URL)
-				recorder := NewResponseRecorder(w)
-				log.Info("Trying to connect to backend server: ", backend.URL) //TODO подумать над уровнями логирования
-				proxy.ServeHTTP(recorder, r)
-
-				if recorder.StatusCode < 500 && !isConnectionError(recorder) {
-					if tracker, ok := balancer.(ConnectionTracker); ok {
-						defer tracker.Release(backend)
-					}
-					return
-				}
-
-				log.Error("Failed to connect to backend server: ", backend.URL)
-				backend.SetAlive(false)
-				balancer.RemoveBackend(backend.Index)
+	status := a.writer.StatusCode()
+	if a.err != nil {
+		status = errorStatus(a.err)
+		span.RecordError(a.err)
+		span.SetStatus(codes.Error, a.err.Error())
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	h.metrics.ObserveAttempt(backend.URL.String(), r.Method, status, latency)
+	success := a.err == nil && status < http.StatusInternalServerError
+	if tracker, ok := h.balancer.(ResultTracker); ok {
+		tracker.Observe(backend, latency, success)
+	}
+	if h.outliers != nil {
+		h.outliers.Report(backend, status, latency)
+	}
+	if h.breakers != nil {
+		h.breakers.Report(backend, success)
+	}
+}
+
+// errResponseAborted - бэкенд оборвал соединение, не дописав тело ответа
+var errResponseAborted = fmt.Errorf("backend response aborted: %w", io.ErrUnexpectedEOF)
+
+// serveAttempt проксирует запрос и сообщает, был ли ответ оборван. ReverseProxy
+// в этом случае паникует с http.ErrAbortHandler, чтобы сервер закрыл соединение.
+func serveAttempt(proxy *httputil.ReverseProxy, w *attemptWriter, r *http.Request) (aborted bool) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			if rec != http.ErrAbortHandler {
+				panic(rec)
 			}
+			aborted = true
+		}
+	}()
+
+	proxy.ServeHTTP(w, r)
 
-			log.Error("Couldn't connect to any server after retries")
-			response.RespondError(w, http.StatusTooManyRequests, "Service unavailable. Try again later", log)
+	return false
+}
+
+// errorStatus выбирает код ответа клиенту для неуспешной попытки
+func errorStatus(err error) int {
+	var se *statusError
+	switch {
+	case errors.As(err, &se):
+		return se.code
+	case classifyError(err) == ErrorTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// nextBackend выбирает бэкенд, на который пускает circuit breaker, не считая exclude. Бэкенды
+// с разомкнутым автоматом убраны из балансировщика, здесь отсекаются полуоткрытые с занятыми
+// пробными слотами. Hash, consistent-hash и sticky для одного запроса всегда выбирают один
+// и тот же бэкенд, поэтому вместо повторного Next перебираются остальные доступные бэкенды пула.
+func nextBackend(balancer Balancer, breakers CircuitBreaker, r *http.Request, exclude ...*bl.Backend) (*bl.Backend, error) {
+	backend, err := balancer.Next(r)
+	if err != nil {
+		return nil, err
+	}
+	if admit(backend, breakers, exclude) {
+		return backend, nil
+	}
+
+	candidates := balancer.Backends()
+	if len(candidates) == 0 {
+		return nil, my_err.ErrNoAliveBackends
+	}
+	start := rand.IntN(len(candidates))
+	for i := range candidates {
+		candidate := candidates[(start+i)%len(candidates)]
+		if candidate != backend && candidate.Available() && admit(candidate, breakers, exclude) {
+			return candidate, nil
 		}
-		return http.HandlerFunc(fn)
 	}
+
+	return nil, my_err.ErrNoAliveBackends
 }
 
-func isConnectionError(recorder *ResponseRecorder) bool {
-	return strings.Contains(recorder.Body.String(), "connection refused")
+// admit проверяет exclude до circuit breaker'а, чтобы не занимать пробный слот зря
+func admit(backend *bl.Backend, breakers CircuitBreaker, exclude []*bl.Backend) bool {
+	if slices.Contains(exclude, backend) {
+		return false
+	}
+
+	return breakers == nil || breakers.Allow(backend)
 }
@@ -0,0 +1,342 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bl "github.com/SlashLight/golang-balancer/internal/balancer"
+	circuit_breaker "github.com/SlashLight/golang-balancer/internal/circuit-breaker"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/metrics"
+)
+
+// sequenceBalancer отдает бэкенды по кругу в заданном порядке
+type sequenceBalancer struct {
+	backends []*bl.Backend
+	mu       sync.Mutex
+	next     int
+}
+
+func (sb *sequenceBalancer) Next(*http.Request) (*bl.Backend, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	back := sb.backends[sb.next%len(sb.backends)]
+	sb.next++
+	return back, nil
+}
+
+func (sb *sequenceBalancer) Backends() []*bl.Backend {
+	return sb.backends
+}
+
+// testBackend - бэкенд, который считает полученные запросы
+type testBackend struct {
+	*httptest.Server
+	hits atomic.Int64
+}
+
+func newTestBackend(t *testing.T, handler http.HandlerFunc) *testBackend {
+	t.Helper()
+
+	tb := &testBackend{}
+	tb.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tb.hits.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(tb.Close)
+
+	return tb
+}
+
+func respond(name string, status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", name)
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
+
+// abortAfter отдает заголовки и часть тела, после чего обрывает соединение
+func abortAfter(name, part string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", name)
+		w.Header().Set("Content-Length", "1000000")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, part)
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// newTestBalancer поднимает балансировщик с maxRetries попытками перед бэкендами
+func newTestBalancer(t *testing.T, maxRetries int, maxBuffer int64, backends ...*testBackend) *httptest.Server {
+	t.Helper()
+
+	lb := &sequenceBalancer{}
+	for _, back := range backends {
+		backend, err := bl.NewBackend(back.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lb.backends = append(lb.backends, backend)
+	}
+
+	return newTestServer(t, lb, nil, maxRetries, maxBuffer)
+}
+
+func newTestServer(t *testing.T, lb Balancer, breakers CircuitBreaker, maxRetries int, maxBuffer int64) *httptest.Server {
+	t.Helper()
+
+	forwarder, err := NewForwarder(config.Forwarding{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxies, err := NewProxies(config.Transport{
+		DialTimeout:           time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		IdleConnTimeout:       time.Minute,
+		MaxIdleConnsPerHost:   4,
+		Protocol:              "auto",
+	}, forwarder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewRetryPolicy(config.RetryPolicy{
+		Methods:          []string{http.MethodGet},
+		Statuses:         []string{"502", "503", "504"},
+		Errors:           []string{ErrorDial, ErrorReset, ErrorTimeout},
+		BudgetPercent:    100,
+		BudgetMinRetries: 10,
+		MaxBufferSize:    maxBuffer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewRetryHandler(lb, proxies, nil, breakers, policy, nil, metrics.NewUpstream("test"), log, maxRetries)
+	srv := httptest.NewServer(AccessLog(log)(handler))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestRetryDropsFailedAttempt(t *testing.T) {
+	failing := newTestBackend(t, respond("a", http.StatusServiceUnavailable, "a: unavailable"))
+	healthy := newTestBackend(t, respond("b", http.StatusOK, "b: ok"))
+	srv := newTestBalancer(t, 2, 1<<20, failing, healthy)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header.Values("X-Backend"); len(got) != 1 || got[0] != "b" {
+		t.Errorf("X-Backend = %q, want only b", got)
+	}
+	if string(body) != "b: ok" {
+		t.Errorf("body = %q, want %q", body, "b: ok")
+	}
+	if failing.hits.Load() != 1 || healthy.hits.Load() != 1 {
+		t.Errorf("hits = %d/%d, want 1/1", failing.hits.Load(), healthy.hits.Load())
+	}
+}
+
+func TestRetryDoesNotRepeatCommittedResponse(t *testing.T) {
+	large := strings.Repeat("a", 4096)
+	failing := newTestBackend(t, abortAfter("a", large))
+	healthy := newTestBackend(t, respond("b", http.StatusOK, "b: ok"))
+	srv := newTestBalancer(t, 2, 1024, failing, healthy)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+
+	if err == nil {
+		t.Error("expected aborted response body")
+	}
+	if resp.Header.Get("X-Backend") != "a" {
+		t.Errorf("X-Backend = %q, want a", resp.Header.Get("X-Backend"))
+	}
+	if strings.Contains(string(body), "b: ok") {
+		t.Error("body of the second backend spliced into committed response")
+	}
+	if healthy.hits.Load() != 0 {
+		t.Errorf("committed response retried on the second backend %d times", healthy.hits.Load())
+	}
+}
+
+func TestRetryAbortedBodyIsNotSpliced(t *testing.T) {
+	first := newTestBackend(t, abortAfter("a", "a: partial"))
+	last := newTestBackend(t, abortAfter("b", "b: partial"))
+	srv := newTestBalancer(t, 2, 1<<20, first, last)
+
+	// заголовки последней попытки могут не успеть уйти клиенту до обрыва соединения
+	resp, err := http.Get(srv.URL)
+	if err == nil {
+		defer resp.Body.Close()
+		var body []byte
+		body, err = io.ReadAll(resp.Body)
+		if got := resp.Header.Values("X-Backend"); len(got) != 1 || got[0] != "b" {
+			t.Errorf("X-Backend = %q, want only b", got)
+		}
+		if strings.Contains(string(body), "a: partial") {
+			t.Errorf("body of the failed attempt spliced into response: %q", body)
+		}
+	}
+
+	if err == nil {
+		t.Error("expected aborted connection")
+	}
+	if first.hits.Load() != 1 || last.hits.Load() != 1 {
+		t.Errorf("hits = %d/%d, want 1/1", first.hits.Load(), last.hits.Load())
+	}
+}
+
+func TestRetryPassesLastAttemptThrough(t *testing.T) {
+	first := newTestBackend(t, respond("a", http.StatusBadGateway, "a: bad gateway"))
+	last := newTestBackend(t, respond("b", http.StatusServiceUnavailable, "b: unavailable"))
+	srv := newTestBalancer(t, 2, 1<<20, first, last)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", resp.StatusCode)
+	}
+	if got := resp.Header.Values("X-Backend"); len(got) != 1 || got[0] != "b" {
+		t.Errorf("X-Backend = %q, want only b", got)
+	}
+	if string(body) != "b: unavailable" {
+		t.Errorf("body = %q, want %q", body, "b: unavailable")
+	}
+}
+
+func TestRetryFlushesStreamingResponse(t *testing.T) {
+	const firstEvent, secondEvent = "data: first\n\n", "data: second\n\n"
+
+	next := make(chan struct{})
+	stream := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, firstEvent)
+		w.(http.Flusher).Flush()
+		<-next
+		io.WriteString(w, secondEvent)
+	})
+	srv := newTestBalancer(t, 2, 1<<20, stream)
+
+	first, rest := make(chan string, 1), make(chan string, 1)
+	go func() {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			first <- err.Error()
+			rest <- ""
+			return
+		}
+		defer resp.Body.Close()
+
+		buf := make([]byte, len(firstEvent))
+		n, _ := io.ReadFull(resp.Body, buf)
+		first <- string(buf[:n])
+		body, _ := io.ReadAll(resp.Body)
+		rest <- string(body)
+	}()
+
+	// первое событие должно дойти до клиента, пока бэкенд еще держит ответ открытым
+	select {
+	case got := <-first:
+		if got != firstEvent {
+			t.Errorf("first event = %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("flushed event didn't reach the client")
+	}
+	close(next)
+
+	if got := <-rest; got != secondEvent {
+		t.Errorf("second event = %q", got)
+	}
+}
+
+func TestHalfOpenHashPickFallsBackToOtherBackend(t *testing.T) {
+	first := newTestBackend(t, respond("a", http.StatusOK, "a: ok"))
+	second := newTestBackend(t, respond("b", http.StatusOK, "b: ok"))
+	hits := map[string]*testBackend{first.URL: first, second.URL: second}
+
+	key := func(r *http.Request) (string, error) { return r.Header.Get("X-Key"), nil }
+	lb, err := bl.NewHashBalancer([]string{first.URL, second.URL}, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breakers := circuit_breaker.NewCircuitBreaker(config.CircuitBreaker{
+		Enabled:          true,
+		FailureRatio:     0.5,
+		MinRequests:      1,
+		Window:           time.Minute,
+		OpenDuration:     10 * time.Millisecond,
+		HalfOpenRequests: 1,
+	}, lb, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	halfOpen := lb.Backends()[0]
+	breakers.Report(halfOpen, false)
+	for breakers.State(halfOpen) != circuit_breaker.StateHalfOpen {
+		time.Sleep(time.Millisecond)
+	}
+	// единственный пробный слот занят другим запросом
+	if !breakers.Allow(halfOpen) {
+		t.Fatal("half-open backend has no probe slot")
+	}
+
+	// ключ, который hash-балансировщик всегда отдает полуоткрытому бэкенду
+	var pinned string
+	for i := 0; pinned == ""; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Key", strconv.Itoa(i))
+		if back, _ := lb.Next(req); back == halfOpen {
+			pinned = strconv.Itoa(i)
+		}
+	}
+
+	srv := newTestServer(t, lb, breakers, 1, 1<<20)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("X-Key", pinned)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200 from the other backend", resp.StatusCode)
+	}
+	if got := hits[halfOpen.URL.String()].hits.Load(); got != 0 {
+		t.Errorf("saturated half-open backend got %d requests", got)
+	}
+}
@@ -0,0 +1,178 @@
+package outlier_detection
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/balancer"
+	"github.com/SlashLight/golang-balancer/internal/config"
+)
+
+type Balancer interface {
+	AddNewBackend(*balancer.Backend)
+	RemoveBackend(int)
+}
+
+// Registry - все бэкенды пула, включая исключенные из балансировки
+type Registry interface {
+	Backends() []*balancer.Backend
+}
+
+type stats struct {
+	consecutive5xx     int
+	consecutiveGateway int
+	consecutiveSlow    int
+	ejections          int
+	readmittedAt       time.Time
+}
+
+// Detector исключает бэкенды по ответам на реальные запросы. Исключенный бэкенд
+// возвращается в балансировку автоматически, время исключения растет вдвое с каждым разом.
+type Detector struct {
+	cfg      config.Outlier
+	lb       Balancer
+	registry Registry
+	stats    map[int]*stats
+	mu       sync.Mutex
+	log      *slog.Logger
+}
+
+func NewDetector(cfg config.Outlier, lb Balancer, registry Registry, log *slog.Logger) *Detector {
+	return &Detector{
+		cfg:      cfg,
+		lb:       lb,
+		registry: registry,
+		stats:    make(map[int]*stats),
+		log:      log,
+	}
+}
+
+func (d *Detector) SetConfig(cfg config.Outlier) {
+	d.mu.Lock()
+	d.cfg = cfg
+	d.mu.Unlock()
+}
+
+// Report учитывает результат одной попытки проксирования на бэкенд
+func (d *Detector) Report(back *balancer.Backend, statusCode int, latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.cfg.Enabled || back.Ejected() {
+		return
+	}
+
+	s, ok := d.stats[back.Index]
+	if !ok {
+		s = &stats{}
+		d.stats[back.Index] = s
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		s.consecutive5xx++
+	} else {
+		s.consecutive5xx = 0
+	}
+	if isGatewayError(statusCode) {
+		s.consecutiveGateway++
+	} else {
+		s.consecutiveGateway = 0
+	}
+	if d.cfg.SlowThreshold > 0 && latency >= d.cfg.SlowThreshold {
+		s.consecutiveSlow++
+	} else {
+		s.consecutiveSlow = 0
+	}
+
+	var reason string
+	switch {
+	case d.cfg.Consecutive5xx > 0 && s.consecutive5xx >= d.cfg.Consecutive5xx:
+		reason = "consecutive 5xx"
+	case d.cfg.ConsecutiveGatewayErrors > 0 && s.consecutiveGateway >= d.cfg.ConsecutiveGatewayErrors:
+		reason = "consecutive gateway errors"
+	case d.cfg.SlowThreshold > 0 && s.consecutiveSlow >= d.cfg.ConsecutiveSlow:
+		reason = "consecutive slow responses"
+	default:
+		return
+	}
+
+	if !d.canEject() {
+		d.log.Warn("max ejection percent reached, backend is kept",
+			slog.String("backend", back.URL.String()),
+			slog.String("reason", reason),
+		)
+		return
+	}
+
+	d.eject(back, s, reason)
+}
+
+// Forget удаляет статистику бэкенда, убранного из пула
+func (d *Detector) Forget(idx int) {
+	d.mu.Lock()
+	delete(d.stats, idx)
+	d.mu.Unlock()
+}
+
+func (d *Detector) eject(back *balancer.Backend, s *stats, reason string) {
+	// бэкенд долго работал без исключений - начинаем отсчет заново
+	if !s.readmittedAt.IsZero() && time.Since(s.readmittedAt) > d.cfg.MaxEjectionTime {
+		s.ejections = 0
+	}
+	s.ejections++
+	s.consecutive5xx, s.consecutiveGateway, s.consecutiveSlow = 0, 0, 0
+
+	duration := d.cfg.BaseEjectionTime
+	for i := 1; i < s.ejections && duration < d.cfg.MaxEjectionTime; i++ {
+		duration *= 2
+	}
+	duration = min(duration, d.cfg.MaxEjectionTime)
+
+	back.SetEjected(true)
+	back.Sync(d.lb)
+	d.log.Warn("backend ejected",
+		slog.String("backend", back.URL.String()),
+		slog.String("reason", reason),
+		slog.String("duration", duration.String()),
+		slog.Int("ejections", s.ejections),
+	)
+
+	time.AfterFunc(duration, func() { d.readmit(back) })
+}
+
+func (d *Detector) readmit(back *balancer.Backend) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.stats[back.Index]
+	if !ok {
+		return
+	}
+	s.readmittedAt = time.Now()
+	// мертвый по активной проверке бэкенд останется вне пула, его вернет health checker
+	back.SetEjected(false)
+	back.Sync(d.lb)
+	d.log.Info("backend readmitted", slog.String("backend", back.URL.String()))
+}
+
+// canEject не дает исключить больше maxEjectionPercent бэкендов пула, но один можно всегда
+func (d *Detector) canEject() bool {
+	backends := d.registry.Backends()
+	ejected := 0
+	for _, back := range backends {
+		if back.Ejected() {
+			ejected++
+		}
+	}
+
+	allowed := max(1, len(backends)*d.cfg.MaxEjectionPercent/100)
+	return ejected < allowed
+}
+
+func isGatewayError(statusCode int) bool {
+	return statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
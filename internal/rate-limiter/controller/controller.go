@@ -41,14 +41,14 @@ func (c *RateLimitController) HandleClients(w http.ResponseWriter, r *http.Reque
 	case http.MethodGet:
 		clientID := r.URL.Query().Get("client_id")
 		if clientID == "" {
-			c.Log.Error("empty client ID")
+			c.Log.ErrorContext(r.Context(), "empty client ID")
 			resp.RespondError(w, http.StatusBadRequest, "no client ID", c.Log)
 			return
 		}
 
 		client, err = c.Repo.ReadClient(r.Context(), clientID)
 		if err != nil {
-			c.Log.Error("error at getting client", logger.Err(err))
+			c.Log.ErrorContext(r.Context(), "error at getting client", logger.Err(err))
 			if errors.Is(err, my_err.ErrUserNotFound) {
 				resp.RespondError(w, http.StatusBadRequest, "client not found", c.Log)
 				return
@@ -59,26 +59,30 @@ func (c *RateLimitController) HandleClients(w http.ResponseWriter, r *http.Reque
 		}
 
 		if err := json.NewEncoder(w).Encode(client); err != nil {
-			c.Log.Error("error at sending JSON", logger.Err(err))
+			c.Log.ErrorContext(r.Context(), "error at sending JSON", logger.Err(err))
 		}
 	case http.MethodPost:
 		if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
-			c.Log.Error("error at getting client from request body", logger.Err(err))
+			c.Log.ErrorContext(r.Context(), "error at getting client from request body", logger.Err(err))
 			return
 		}
 
 		if client.ClientIP == "" {
-			c.Log.Error("empty client IP")
+			c.Log.ErrorContext(r.Context(), "empty client IP")
 			resp.RespondError(w, http.StatusBadRequest, "Client IP is empty", c.Log)
 			return
 		}
 
 		if err = c.Repo.CreateClient(r.Context(), client); err != nil {
-			c.Log.Error("error at creating client", logger.Err(err))
+			c.Log.ErrorContext(r.Context(), "error at creating client", logger.Err(err))
 			if errors.Is(err, my_err.ErrUserAlreadyExists) {
 				resp.RespondError(w, http.StatusBadRequest, "client already exists", c.Log)
 				return
 			}
+			if errors.Is(err, my_err.ErrInvalidRateLimit) {
+				resp.RespondError(w, http.StatusBadRequest, err.Error(), c.Log)
+				return
+			}
 
 			resp.RespondError(w, http.StatusInternalServerError, "error at creating client", c.Log)
 			return
@@ -87,16 +91,20 @@ func (c *RateLimitController) HandleClients(w http.ResponseWriter, r *http.Reque
 		resp.RespondOK(w, http.StatusOK, c.Log)
 	case http.MethodPut:
 		if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
-			c.Log.Error("error at getting client from request body", logger.Err(err))
+			c.Log.ErrorContext(r.Context(), "error at getting client from request body", logger.Err(err))
 			return
 		}
 
 		if err = c.Repo.UpdateClient(r.Context(), client); err != nil {
-			c.Log.Error("error at updating client", logger.Err(err))
+			c.Log.ErrorContext(r.Context(), "error at updating client", logger.Err(err))
 			if errors.Is(err, my_err.ErrUserNotFound) {
 				resp.RespondError(w, http.StatusBadRequest, "client not exists", c.Log)
 				return
 			}
+			if errors.Is(err, my_err.ErrInvalidRateLimit) {
+				resp.RespondError(w, http.StatusBadRequest, err.Error(), c.Log)
+				return
+			}
 			resp.RespondError(w, http.StatusInternalServerError, "error at updating client", c.Log)
 			return
 		}
@@ -105,14 +113,14 @@ func (c *RateLimitController) HandleClients(w http.ResponseWriter, r *http.Reque
 	case http.MethodDelete:
 		clientID := r.URL.Query().Get("client_id")
 		if clientID == "" {
-			c.Log.Error("empty client ID")
+			c.Log.ErrorContext(r.Context(), "empty client ID")
 			resp.RespondError(w, http.StatusBadRequest, "no client ID", c.Log)
 			return
 		}
 
 		err = c.Repo.DeleteClient(r.Context(), clientID)
 		if err != nil {
-			c.Log.Error("error at getting client", logger.Err(err))
+			c.Log.ErrorContext(r.Context(), "error at getting client", logger.Err(err))
 			if errors.Is(err, my_err.ErrUserNotFound) {
 				resp.RespondError(w, http.StatusBadRequest, "client not exists", c.Log)
 				return
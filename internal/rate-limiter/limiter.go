@@ -0,0 +1,265 @@
+package rate_limiter
+
+import (
+	"math"
+	"time"
+)
+
+// Limiter - состояние лимита одного клиента. Методы не потокобезопасны,
+// хранилище вызывает их под своей блокировкой.
+type Limiter interface {
+	// Allow решает, пропустить ли запрос, и учитывает его
+	Allow(now time.Time) bool
+	// Release завершает запрос. Имеет смысл только для concurrency.
+	Release()
+	// Remaining возвращает, сколько запросов можно сделать прямо сейчас
+	Remaining(now time.Time) int
+	// Busy сообщает, что есть незавершенные запросы и состояние нельзя удалять
+	Busy() bool
+	// Update меняет параметры политики того же алгоритма, сохраняя состояние
+	Update(p Policy, now time.Time)
+}
+
+// NewLimiter создает пустое состояние для политики. Политика должна быть проверена Validate.
+func NewLimiter(p Policy, now time.Time) Limiter {
+	switch p.Algorithm {
+	case AlgorithmGCRA:
+		return &gcra{interval: time.Second / time.Duration(p.Rate), burst: p.Capacity}
+	case AlgorithmFixedWindow:
+		return &fixedWindow{window: p.Window, limit: p.Capacity}
+	case AlgorithmSlidingLog:
+		return &slidingLog{window: p.Window, limit: p.Capacity}
+	case AlgorithmSlidingCounter:
+		return &slidingCounter{window: p.Window, limit: p.Capacity}
+	case AlgorithmConcurrency:
+		return &concurrency{limit: p.Capacity}
+	default:
+		return &tokenBucket{capacity: float64(p.Capacity), rate: float64(p.Rate), tokens: float64(p.Capacity), last: now}
+	}
+}
+
+type tokenBucket struct {
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	if now.After(tb.last) {
+		tb.tokens = min(tb.capacity, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+		tb.last = now
+	}
+}
+
+func (tb *tokenBucket) Allow(now time.Time) bool {
+	tb.refill(now)
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+func (tb *tokenBucket) Release() {}
+
+func (tb *tokenBucket) Remaining(now time.Time) int {
+	tb.refill(now)
+	return int(tb.tokens)
+}
+
+func (tb *tokenBucket) Busy() bool { return false }
+
+func (tb *tokenBucket) Update(p Policy, now time.Time) {
+	tb.refill(now)
+	tb.capacity, tb.rate = float64(p.Capacity), float64(p.Rate)
+	tb.tokens = min(tb.tokens, tb.capacity)
+}
+
+// gcra хранит теоретическое время прихода следующего запроса (TAT). Запрос проходит,
+// если TAT опережает текущее время не больше чем на burst-1 интервалов.
+type gcra struct {
+	interval time.Duration
+	burst    int
+	tat      time.Time
+}
+
+func (g *gcra) Allow(now time.Time) bool {
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	if tat.Sub(now) > g.interval*time.Duration(g.burst-1) {
+		return false
+	}
+	g.tat = tat.Add(g.interval)
+	return true
+}
+
+func (g *gcra) Release() {}
+
+func (g *gcra) Remaining(now time.Time) int {
+	ahead := max(g.tat.Sub(now), 0)
+	return max(int((g.interval*time.Duration(g.burst)-ahead)/g.interval), 0)
+}
+
+func (g *gcra) Busy() bool { return false }
+
+func (g *gcra) Update(p Policy, _ time.Time) {
+	g.interval, g.burst = time.Second/time.Duration(p.Rate), p.Capacity
+}
+
+type fixedWindow struct {
+	window time.Duration
+	limit  int
+	start  time.Time
+	count  int
+}
+
+func (fw *fixedWindow) roll(now time.Time) {
+	if start := now.Truncate(fw.window); !start.Equal(fw.start) {
+		fw.start, fw.count = start, 0
+	}
+}
+
+func (fw *fixedWindow) Allow(now time.Time) bool {
+	fw.roll(now)
+	if fw.count >= fw.limit {
+		return false
+	}
+	fw.count++
+	return true
+}
+
+func (fw *fixedWindow) Release() {}
+
+func (fw *fixedWindow) Remaining(now time.Time) int {
+	fw.roll(now)
+	return fw.limit - fw.count
+}
+
+func (fw *fixedWindow) Busy() bool { return false }
+
+func (fw *fixedWindow) Update(p Policy, now time.Time) {
+	fw.window, fw.limit = p.Window, p.Capacity
+	fw.roll(now)
+}
+
+// slidingLog хранит время каждого разрешенного запроса за последнее окно
+type slidingLog struct {
+	window time.Duration
+	limit  int
+	log    []time.Time
+}
+
+func (sl *slidingLog) trim(now time.Time) {
+	cutoff := now.Add(-sl.window)
+	i := 0
+	for i < len(sl.log) && !sl.log[i].After(cutoff) {
+		i++
+	}
+	sl.log = sl.log[i:]
+}
+
+func (sl *slidingLog) Allow(now time.Time) bool {
+	sl.trim(now)
+	if len(sl.log) >= sl.limit {
+		return false
+	}
+	sl.log = append(sl.log, now)
+	return true
+}
+
+func (sl *slidingLog) Release() {}
+
+func (sl *slidingLog) Remaining(now time.Time) int {
+	sl.trim(now)
+	return sl.limit - len(sl.log)
+}
+
+func (sl *slidingLog) Busy() bool { return false }
+
+func (sl *slidingLog) Update(p Policy, _ time.Time) {
+	sl.window, sl.limit = p.Window, p.Capacity
+}
+
+// slidingCounter считает запросы в текущем окне и добавляет к ним часть предыдущего окна,
+// пропорциональную тому, насколько скользящее окно его еще перекрывает
+type slidingCounter struct {
+	window time.Duration
+	limit  int
+	start  time.Time
+	count  int
+	prev   int
+}
+
+func (sc *slidingCounter) roll(now time.Time) {
+	start := now.Truncate(sc.window)
+	if start.Equal(sc.start) {
+		return
+	}
+	if start.Sub(sc.start) == sc.window {
+		sc.prev = sc.count
+	} else {
+		sc.prev = 0
+	}
+	sc.start, sc.count = start, 0
+}
+
+func (sc *slidingCounter) estimate(now time.Time) float64 {
+	weight := float64(sc.window-now.Sub(sc.start)) / float64(sc.window)
+	return float64(sc.prev)*weight + float64(sc.count)
+}
+
+func (sc *slidingCounter) Allow(now time.Time) bool {
+	sc.roll(now)
+	if sc.estimate(now)+1 > float64(sc.limit) {
+		return false
+	}
+	sc.count++
+	return true
+}
+
+func (sc *slidingCounter) Release() {}
+
+func (sc *slidingCounter) Remaining(now time.Time) int {
+	sc.roll(now)
+	return max(int(math.Floor(float64(sc.limit)-sc.estimate(now))), 0)
+}
+
+func (sc *slidingCounter) Busy() bool { return false }
+
+func (sc *slidingCounter) Update(p Policy, now time.Time) {
+	if p.Window != sc.window {
+		sc.start, sc.count, sc.prev = time.Time{}, 0, 0
+	}
+	sc.window, sc.limit = p.Window, p.Capacity
+	sc.roll(now)
+}
+
+type concurrency struct {
+	limit    int
+	inFlight int
+}
+
+func (c *concurrency) Allow(time.Time) bool {
+	if c.inFlight >= c.limit {
+		return false
+	}
+	c.inFlight++
+	return true
+}
+
+func (c *concurrency) Release() {
+	c.inFlight = max(c.inFlight-1, 0)
+}
+
+func (c *concurrency) Remaining(time.Time) int {
+	return c.limit - c.inFlight
+}
+
+func (c *concurrency) Busy() bool { return c.inFlight > 0 }
+
+func (c *concurrency) Update(p Policy, _ time.Time) {
+	c.limit = p.Capacity
+}
@@ -0,0 +1,83 @@
+package rate_limiter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const (
+	// AlgorithmTokenBucket - бакет на Capacity токенов, пополняется на Rate токенов в секунду
+	AlgorithmTokenBucket = "token-bucket"
+	// AlgorithmGCRA - generic cell rate: Rate запросов в секунду с всплеском до Capacity
+	AlgorithmGCRA = "gcra"
+	// AlgorithmFixedWindow - не больше Capacity запросов в каждом окне Window
+	AlgorithmFixedWindow = "fixed-window"
+	// AlgorithmSlidingLog - не больше Capacity запросов за последние Window, хранит время каждого запроса
+	AlgorithmSlidingLog = "sliding-log"
+	// AlgorithmSlidingCounter - приближение sliding-log по счетчикам текущего и предыдущего окна
+	AlgorithmSlidingCounter = "sliding-counter"
+	// AlgorithmConcurrency - не больше Capacity одновременных запросов
+	AlgorithmConcurrency = "concurrency"
+)
+
+// Policy - алгоритм и параметры лимита клиента
+type Policy struct {
+	Algorithm string
+	Capacity  int
+	Rate      int
+	Window    time.Duration
+}
+
+func (p Policy) Validate() error {
+	switch p.Algorithm {
+	case AlgorithmTokenBucket, AlgorithmGCRA:
+		if p.Rate < 1 {
+			return fmt.Errorf("%w: %s needs rate >= 1", my_err.ErrInvalidRateLimit, p.Algorithm)
+		}
+	case AlgorithmFixedWindow, AlgorithmSlidingLog, AlgorithmSlidingCounter:
+		if p.Window < time.Millisecond {
+			return fmt.Errorf("%w: %s needs window >= 1ms", my_err.ErrInvalidRateLimit, p.Algorithm)
+		}
+	case AlgorithmConcurrency:
+	default:
+		return fmt.Errorf("%w: unknown algorithm %q", my_err.ErrInvalidRateLimit, p.Algorithm)
+	}
+	if p.Capacity < 1 {
+		return fmt.Errorf("%w: capacity must be positive", my_err.ErrInvalidRateLimit)
+	}
+
+	return nil
+}
+
+// Merge заменяет параметры политики ненулевыми параметрами клиента
+func (p Policy) Merge(c *Client) Policy {
+	if c.Algorithm != "" {
+		p.Algorithm = c.Algorithm
+	}
+	if c.Capacity != 0 {
+		p.Capacity = c.Capacity
+	}
+	if c.Rate != 0 {
+		p.Rate = c.Rate
+	}
+	if c.WindowMs != 0 {
+		p.Window = time.Duration(c.WindowMs) * time.Millisecond
+	}
+
+	return p
+}
+
+// Client заполняет параметры клиента из политики
+func (p Policy) Client(clientIP string) *Client {
+	return &Client{
+		ClientIP:  clientIP,
+		Algorithm: p.Algorithm,
+		WindowMs:  p.Window.Milliseconds(),
+		TokenBucket: TokenBucket{
+			Capacity: p.Capacity,
+			Rate:     p.Rate,
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/logger"
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
+)
+
+// FallbackRateLimiter проверяет лимиты в Redis, а если Redis недоступен - в памяти процесса.
+// Клиенты через API управляются только в Redis, поэтому в памяти действуют лимиты по умолчанию.
+type FallbackRateLimiter struct {
+	primary  *RedisRateLimiter
+	fallback *MemoryRateLimiter
+	warnedAt atomic.Int64
+	log      *slog.Logger
+}
+
+// fallbackWarnInterval - пока Redis недоступен, предупреждение пишется не чаще раза в этот интервал
+const fallbackWarnInterval = 10 * time.Second
+
+func NewFallbackRateLimiter(primary *RedisRateLimiter, fallback *MemoryRateLimiter, log *slog.Logger) *FallbackRateLimiter {
+	return &FallbackRateLimiter{
+		primary:  primary,
+		fallback: fallback,
+		log:      log.With(slog.String("component", "rate-limiter")),
+	}
+}
+
+func (rl *FallbackRateLimiter) Allow(ctx context.Context, userIP string) (bool, func(), error) {
+	allowed, release, err := rl.primary.Allow(ctx, userIP)
+	if err == nil || ctx.Err() != nil {
+		return allowed, release, err
+	}
+
+	now := time.Now().UnixNano()
+	if last := rl.warnedAt.Load(); now-last >= int64(fallbackWarnInterval) && rl.warnedAt.CompareAndSwap(last, now) {
+		rl.log.WarnContext(ctx, "redis rate limiter failed, using in-memory limiter", logger.Err(err))
+	}
+	return rl.fallback.Allow(ctx, userIP)
+}
+
+func (rl *FallbackRateLimiter) SetDefaults(policy rate_limiter.Policy) {
+	rl.primary.SetDefaults(policy)
+	rl.fallback.SetDefaults(policy)
+}
+
+func (rl *FallbackRateLimiter) CreateClient(ctx context.Context, user *rate_limiter.Client) error {
+	return rl.primary.CreateClient(ctx, user)
+}
+
+func (rl *FallbackRateLimiter) ReadClient(ctx context.Context, userIP string) (*rate_limiter.Client, error) {
+	return rl.primary.ReadClient(ctx, userIP)
+}
+
+func (rl *FallbackRateLimiter) UpdateClient(ctx context.Context, newClient *rate_limiter.Client) error {
+	return rl.primary.UpdateClient(ctx, newClient)
+}
+
+func (rl *FallbackRateLimiter) DeleteClient(ctx context.Context, clientIP string) error {
+	return rl.primary.DeleteClient(ctx, clientIP)
+}
+
+func (rl *FallbackRateLimiter) Close() error {
+	rl.fallback.Close()
+	return rl.primary.Close()
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
+)
+
+func TestFallbackRateLimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		redisDown bool
+	}{
+		{name: "redis available"},
+		{name: "redis down", redisDown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			cfg := newTestConfig(rate_limiter.AlgorithmFixedWindow, 1)
+			cfg.Redis.Addr = mr.Addr()
+			cfg.Redis.DialTimeout = 100 * time.Millisecond
+			cfg.Redis.ReadTimeout = 100 * time.Millisecond
+			cfg.Redis.WriteTimeout = 100 * time.Millisecond
+
+			memory := NewMemoryRateLimiter(cfg)
+			rl := NewFallbackRateLimiter(NewRedisRateLimiter(cfg), memory, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			defer rl.Close()
+			if tt.redisDown {
+				mr.Close()
+			}
+
+			ctx := context.Background()
+			allowed, _, err := rl.Allow(ctx, "10.0.0.1")
+			if err != nil || !allowed {
+				t.Fatalf("allowed = %v, err = %v", allowed, err)
+			}
+			if allowed, _, _ = rl.Allow(ctx, "10.0.0.1"); allowed {
+				t.Error("request over capacity allowed")
+			}
+
+			// лимит учитывается ровно в одном хранилище
+			_, err = memory.ReadClient(ctx, "10.0.0.1")
+			if inMemory := err == nil; inMemory != tt.redisDown {
+				t.Errorf("client in memory = %v, want %v", inMemory, tt.redisDown)
+			}
+			if !tt.redisDown && !mr.Exists(clientKey("10.0.0.1")) {
+				t.Error("client is not stored in redis")
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+// MemoryRateLimiter хранит лимиты в памяти процесса. Клиенты разбиты на шарды со своими
+// мьютексами, чтобы запросы разных клиентов не ждали друг друга. Клиенты, созданные по первому
+// запросу, удаляются после IdleTTL без запросов; клиенты, созданные через API, не удаляются.
+type MemoryRateLimiter struct {
+	shards   []*memoryShard
+	seed     maphash.Seed
+	idleTTL  time.Duration
+	defaults rate_limiter.Policy
+	mu       sync.RWMutex
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type memoryShard struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	policy   rate_limiter.Policy
+	limiter  rate_limiter.Limiter
+	lastSeen time.Time
+	// managed - клиент создан или изменен через API
+	managed bool
+}
+
+func NewMemoryRateLimiter(cfg *config.Config) *MemoryRateLimiter {
+	shards := make([]*memoryShard, max(cfg.RateLimit.Shards, 1))
+	for i := range shards {
+		shards[i] = &memoryShard{entries: make(map[string]*memoryEntry)}
+	}
+
+	rl := &MemoryRateLimiter{
+		shards:   shards,
+		seed:     maphash.MakeSeed(),
+		idleTTL:  cfg.RateLimit.IdleTTL,
+		defaults: cfg.RateLimit.DefaultPolicy(),
+		stop:     make(chan struct{}),
+	}
+	go rl.evictIdle()
+
+	return rl
+}
+
+// SetDefaults меняет политику для клиентов без индивидуальных настроек
+func (rl *MemoryRateLimiter) SetDefaults(policy rate_limiter.Policy) {
+	rl.mu.Lock()
+	rl.defaults = policy
+	rl.mu.Unlock()
+}
+
+func (rl *MemoryRateLimiter) policy() rate_limiter.Policy {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.defaults
+}
+
+func (rl *MemoryRateLimiter) shard(clientIP string) *memoryShard {
+	return rl.shards[maphash.String(rl.seed, clientIP)%uint64(len(rl.shards))]
+}
+
+func newMemoryEntry(p rate_limiter.Policy, now time.Time, managed bool) *memoryEntry {
+	return &memoryEntry{policy: p, limiter: rate_limiter.NewLimiter(p, now), lastSeen: now, managed: managed}
+}
+
+func (rl *MemoryRateLimiter) Allow(_ context.Context, userIP string) (bool, func(), error) {
+	now := time.Now()
+	s := rl.shard(userIP)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[userIP]
+	// политика по умолчанию могла смениться при перезагрузке конфига
+	if !ok || !e.managed && e.policy != rl.policy() && !e.limiter.Busy() {
+		e = newMemoryEntry(rl.policy(), now, false)
+		s.entries[userIP] = e
+	}
+
+	e.lastSeen = now
+	if !e.limiter.Allow(now) {
+		return false, nil, nil
+	}
+	if e.policy.Algorithm != rate_limiter.AlgorithmConcurrency {
+		return true, nil, nil
+	}
+
+	release := func() {
+		s.mu.Lock()
+		e.limiter.Release()
+		e.lastSeen = time.Now()
+		s.mu.Unlock()
+	}
+	return true, release, nil
+}
+
+func (rl *MemoryRateLimiter) CreateClient(_ context.Context, user *rate_limiter.Client) error {
+	p := rl.policy().Merge(user)
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	*user = *p.Client(user.ClientIP)
+
+	s := rl.shard(user.ClientIP)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[user.ClientIP]; ok {
+		return my_err.ErrUserAlreadyExists
+	}
+	s.entries[user.ClientIP] = newMemoryEntry(p, time.Now(), true)
+
+	return nil
+}
+
+func (rl *MemoryRateLimiter) ReadClient(_ context.Context, userIP string) (*rate_limiter.Client, error) {
+	s := rl.shard(userIP)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[userIP]
+	if !ok {
+		return nil, my_err.ErrUserNotFound
+	}
+
+	client := e.policy.Client(userIP)
+	client.Tokens = e.limiter.Remaining(time.Now())
+	client.LastUpdate = e.lastSeen.Unix()
+
+	return client, nil
+}
+
+// UpdateClient меняет заданные (ненулевые) параметры клиента. При смене алгоритма
+// состояние начинается заново, иначе сохраняется.
+func (rl *MemoryRateLimiter) UpdateClient(_ context.Context, newClient *rate_limiter.Client) error {
+	s := rl.shard(newClient.ClientIP)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[newClient.ClientIP]
+	if !ok {
+		return my_err.ErrUserNotFound
+	}
+
+	p := e.policy.Merge(newClient)
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if p.Algorithm != e.policy.Algorithm {
+		e.limiter = rate_limiter.NewLimiter(p, now)
+	} else {
+		e.limiter.Update(p, now)
+	}
+	e.policy = p
+	e.managed = true
+
+	return nil
+}
+
+func (rl *MemoryRateLimiter) DeleteClient(_ context.Context, clientIP string) error {
+	s := rl.shard(clientIP)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[clientIP]; !ok {
+		return my_err.ErrUserNotFound
+	}
+	delete(s.entries, clientIP)
+
+	return nil
+}
+
+// Close останавливает удаление простаивающих клиентов
+func (rl *MemoryRateLimiter) Close() error {
+	rl.stopOnce.Do(func() { close(rl.stop) })
+	return nil
+}
+
+// evictIdle удаляет клиентов, к которым не обращались дольше idleTTL и у которых нет
+// незавершенных запросов. Если idleTTL не меньше capacity/rate и окна, состояние такого
+// клиента уже не ограничивает запросы и его удаление не меняет лимиты.
+func (rl *MemoryRateLimiter) evictIdle() {
+	ticker := time.NewTicker(max(rl.idleTTL/2, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.stop:
+			return
+		case now := <-ticker.C:
+			rl.evict(now)
+		}
+	}
+}
+
+func (rl *MemoryRateLimiter) evict(now time.Time) {
+	for _, s := range rl.shards {
+		s.mu.Lock()
+		for ip, e := range s.entries {
+			if !e.managed && !e.limiter.Busy() && now.Sub(e.lastSeen) > rl.idleTTL {
+				delete(s.entries, ip)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
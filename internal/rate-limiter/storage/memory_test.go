@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+func newTestConfig(algorithm string, capacity int) *config.Config {
+	return &config.Config{RateLimit: config.RateLimit{
+		Algorithm:       algorithm,
+		DefaultCapacity: capacity,
+		DefaultRate:     1,
+		Window:          time.Minute,
+		LeaseTimeout:    time.Minute,
+		Shards:          4,
+		IdleTTL:         time.Minute,
+	}}
+}
+
+func newTestMemory(t *testing.T, algorithm string, capacity int) *MemoryRateLimiter {
+	t.Helper()
+
+	rl := NewMemoryRateLimiter(newTestConfig(algorithm, capacity))
+	t.Cleanup(func() { rl.Close() })
+
+	return rl
+}
+
+// newLimiter создает хранилище лимитов с политикой по умолчанию algorithm и capacity
+type newLimiter func(t *testing.T, algorithm string, capacity int) RateLimiter
+
+func newMemoryLimiter(t *testing.T, algorithm string, capacity int) RateLimiter {
+	return newTestMemory(t, algorithm, capacity)
+}
+
+func TestMemoryAllow(t *testing.T) {
+	testAllow(t, newMemoryLimiter)
+}
+
+func TestMemoryClients(t *testing.T) {
+	testClients(t, newMemoryLimiter)
+}
+
+func TestMemoryUpdateKeepsState(t *testing.T) {
+	testUpdateKeepsState(t, newMemoryLimiter)
+}
+
+// testAllow проверяет каждый алгоритм: capacity запросов проходят, следующий - нет
+func testAllow(t *testing.T, newLimiter newLimiter) {
+	algorithms := []string{
+		rate_limiter.AlgorithmTokenBucket,
+		rate_limiter.AlgorithmGCRA,
+		rate_limiter.AlgorithmFixedWindow,
+		rate_limiter.AlgorithmSlidingLog,
+		rate_limiter.AlgorithmSlidingCounter,
+		rate_limiter.AlgorithmConcurrency,
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			rl := newLimiter(t, algorithm, 2)
+			ctx := context.Background()
+
+			var releases []func()
+			for i := range 2 {
+				allowed, release, err := rl.Allow(ctx, "10.0.0.1")
+				if err != nil || !allowed {
+					t.Fatalf("request %d: allowed = %v, err = %v", i+1, allowed, err)
+				}
+				if (release != nil) != (algorithm == rate_limiter.AlgorithmConcurrency) {
+					t.Fatalf("request %d: release returned = %v", i+1, release != nil)
+				}
+				releases = append(releases, release)
+			}
+
+			if allowed, _, _ := rl.Allow(ctx, "10.0.0.1"); allowed {
+				t.Error("request over capacity allowed")
+			}
+			if allowed, _, _ := rl.Allow(ctx, "10.0.0.2"); !allowed {
+				t.Error("limit of one client applied to another")
+			}
+
+			if algorithm != rate_limiter.AlgorithmConcurrency {
+				return
+			}
+			releases[0]()
+			if allowed, _, _ := rl.Allow(ctx, "10.0.0.1"); !allowed {
+				t.Error("released slot is not reused")
+			}
+		})
+	}
+}
+
+// testClients проверяет ошибки управления клиентами через API
+func testClients(t *testing.T, newLimiter newLimiter) {
+	const ip = "10.0.0.1"
+
+	tests := []struct {
+		name string
+		op   func(ctx context.Context, rl RateLimiter) error
+		want error
+	}{
+		{
+			name: "create",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				return rl.CreateClient(ctx, &rate_limiter.Client{ClientIP: "10.0.0.2"})
+			},
+		},
+		{
+			name: "create existing",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				return rl.CreateClient(ctx, &rate_limiter.Client{ClientIP: ip})
+			},
+			want: my_err.ErrUserAlreadyExists,
+		},
+		{
+			name: "create invalid",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				return rl.CreateClient(ctx, &rate_limiter.Client{ClientIP: "10.0.0.2", Algorithm: "leaky-bucket"})
+			},
+			want: my_err.ErrInvalidRateLimit,
+		},
+		{
+			name: "read",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				_, err := rl.ReadClient(ctx, ip)
+				return err
+			},
+		},
+		{
+			name: "read missing",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				_, err := rl.ReadClient(ctx, "10.0.0.2")
+				return err
+			},
+			want: my_err.ErrUserNotFound,
+		},
+		{
+			name: "update",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				return rl.UpdateClient(ctx, &rate_limiter.Client{ClientIP: ip, TokenBucket: rate_limiter.TokenBucket{Capacity: 10}})
+			},
+		},
+		{
+			name: "update missing",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				return rl.UpdateClient(ctx, &rate_limiter.Client{ClientIP: "10.0.0.2", TokenBucket: rate_limiter.TokenBucket{Capacity: 10}})
+			},
+			want: my_err.ErrUserNotFound,
+		},
+		{
+			name: "update invalid",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				return rl.UpdateClient(ctx, &rate_limiter.Client{ClientIP: ip, Algorithm: rate_limiter.AlgorithmFixedWindow, WindowMs: -1})
+			},
+			want: my_err.ErrInvalidRateLimit,
+		},
+		{
+			name: "delete",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				return rl.DeleteClient(ctx, ip)
+			},
+		},
+		{
+			name: "delete missing",
+			op: func(ctx context.Context, rl RateLimiter) error {
+				return rl.DeleteClient(ctx, "10.0.0.2")
+			},
+			want: my_err.ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := newLimiter(t, rate_limiter.AlgorithmTokenBucket, 5)
+			ctx := context.Background()
+			if err := rl.CreateClient(ctx, &rate_limiter.Client{ClientIP: ip}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.op(ctx, rl); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// testUpdateKeepsState проверяет, что изменение параметров сохраняет состояние, а смена алгоритма - нет
+func testUpdateKeepsState(t *testing.T, newLimiter newLimiter) {
+	rl := newLimiter(t, rate_limiter.AlgorithmTokenBucket, 5)
+	ctx := context.Background()
+
+	client := &rate_limiter.Client{ClientIP: "10.0.0.1", TokenBucket: rate_limiter.TokenBucket{Capacity: 3}}
+	if err := rl.CreateClient(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if client.Capacity != 3 || client.Rate != 1 || client.Algorithm != rate_limiter.AlgorithmTokenBucket {
+		t.Errorf("created client = %+v, want defaults merged with capacity 3", client)
+	}
+	for range 3 {
+		rl.Allow(ctx, "10.0.0.1")
+	}
+
+	if err := rl.UpdateClient(ctx, &rate_limiter.Client{ClientIP: "10.0.0.1", TokenBucket: rate_limiter.TokenBucket{Capacity: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := rl.ReadClient(ctx, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Capacity != 10 || got.Tokens != 0 {
+		t.Errorf("client = %+v, want capacity 10 with spent tokens kept", got)
+	}
+
+	// при смене алгоритма состояние начинается заново
+	if err := rl.UpdateClient(ctx, &rate_limiter.Client{ClientIP: "10.0.0.1", Algorithm: rate_limiter.AlgorithmFixedWindow}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = rl.ReadClient(ctx, "10.0.0.1"); got.Tokens != 10 {
+		t.Errorf("tokens after algorithm change = %d, want 10", got.Tokens)
+	}
+}
+
+func TestMemoryEvictsIdleClients(t *testing.T) {
+	rl := newTestMemory(t, rate_limiter.AlgorithmConcurrency, 5)
+	ctx := context.Background()
+
+	_, release, _ := rl.Allow(ctx, "idle")
+	release()
+	rl.Allow(ctx, "busy")
+	if err := rl.CreateClient(ctx, &rate_limiter.Client{ClientIP: "managed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rl.evict(time.Now())
+	if _, err := rl.ReadClient(ctx, "idle"); err != nil {
+		t.Fatalf("client evicted before idleTTL: %v", err)
+	}
+
+	rl.evict(time.Now().Add(2 * rl.idleTTL))
+	tests := []struct {
+		ip   string
+		want error
+	}{
+		{ip: "idle", want: my_err.ErrUserNotFound},
+		{ip: "busy"},
+		{ip: "managed"},
+	}
+	for _, tt := range tests {
+		if _, err := rl.ReadClient(ctx, tt.ip); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.ip, err, tt.want)
+		}
+	}
+}
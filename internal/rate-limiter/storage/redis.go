@@ -2,25 +2,29 @@ package storage
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 
 	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/metrics"
 	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
+	"github.com/SlashLight/golang-balancer/internal/tracing"
 	"github.com/SlashLight/golang-balancer/pkg/my_err"
 )
 
 type RedisRateLimiter struct {
-	Client          *redis.Client
-	defaultCapacity int
-	defaultRate     int
+	Client       *redis.Client
+	defaults     rate_limiter.Policy
+	idleTTL      time.Duration
+	leaseTimeout time.Duration
+	mu           sync.RWMutex
 }
 
-const TimeFormat = time.RFC3339
-
 func NewRedisRateLimiter(cfg *config.Config) *RedisRateLimiter {
 	client := redis.NewClient(&redis.Options{
 		Addr:         cfg.Redis.Addr,
@@ -29,205 +33,185 @@ func NewRedisRateLimiter(cfg *config.Config) *RedisRateLimiter {
 		WriteTimeout: cfg.Redis.WriteTimeout,
 		PoolSize:     cfg.Redis.Pool,
 	})
+	client.AddHook(metrics.RedisHook{})
+	client.AddHook(tracing.RedisHook{})
 
 	return &RedisRateLimiter{
-		Client:          client,
-		defaultCapacity: cfg.DefaultCapacity,
-		defaultRate:     cfg.DefaultRate,
+		Client:       client,
+		defaults:     cfg.RateLimit.DefaultPolicy(),
+		idleTTL:      cfg.RateLimit.IdleTTL,
+		leaseTimeout: cfg.RateLimit.LeaseTimeout,
 	}
 }
 
-func (rl *RedisRateLimiter) Allow(ctx context.Context, userIP string) (bool, error) {
-	key := "user:" + userIP + ":tokens"
-
-	var allowed bool
-	err := rl.Client.Watch(ctx, func(tx *redis.Tx) error {
-
-		data, err := rl.ReadClient(ctx, userIP)
-		var tb rate_limiter.TokenBucket
-
-		if errors.Is(err, my_err.ErrUserNotFound) {
-			tb = rate_limiter.TokenBucket{
-				Tokens:     rl.defaultCapacity - 1,
-				LastUpdate: time.Now().Unix(),
-				Capacity:   rl.defaultCapacity,
-				Rate:       rl.defaultRate,
-			}
-			allowed = true
-		} else if err != nil {
-			return err
-		} else {
-			tb = data.TokenBucket
-			if err != nil {
-				return err
-			}
-
-			now := time.Now().Unix()
-			since := now - tb.LastUpdate
-			newTokens := tb.Tokens + int(since)*tb.Rate
-			newTokens = min(newTokens, tb.Capacity)
-
-			if newTokens < 1 {
-				allowed = false
-				return nil
-			}
-
-			tb.Tokens = newTokens - 1
-			tb.LastUpdate = now
-			allowed = true
-
-		}
-
-		_, err = tx.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
-			_, err := pipeliner.HSet(ctx, key,
-				"tokens", tb.Tokens,
-				"last_update", time.Now().Format(TimeFormat),
-				"capacity", tb.Capacity,
-				"rate", tb.Rate,
-			).Result()
+// SetDefaults меняет политику для клиентов без индивидуальных настроек
+func (rl *RedisRateLimiter) SetDefaults(policy rate_limiter.Policy) {
+	rl.mu.Lock()
+	rl.defaults = policy
+	rl.mu.Unlock()
+}
 
-			return err
-		})
+func (rl *RedisRateLimiter) policy() rate_limiter.Policy {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.defaults
+}
 
-		return err
-	}, key)
+// run выполняет allowScript. С peek запрос не учитывается.
+func (rl *RedisRateLimiter) run(ctx context.Context, userIP, requestID string, peek bool) ([]interface{}, error) {
+	p := rl.policy()
+	peekArg := 0
+	if peek {
+		peekArg = 1
+	}
 
-	return allowed, err
+	return allowScript.Run(ctx, rl.Client, clientKeys(userIP),
+		p.Algorithm, p.Capacity, p.Rate, p.Window.Milliseconds(),
+		rl.idleTTL.Milliseconds(), rl.leaseTimeout.Milliseconds(), requestID, peekArg,
+	).Slice()
 }
 
-func (rl *RedisRateLimiter) CreateClient(ctx context.Context, user *rate_limiter.Client) error {
-	key := "user:" + user.ClientIP + ":tokens"
-	if user.Capacity == 0 {
-		user.Capacity = rl.defaultCapacity
+// Allow проверяет лимит клиента за один запрос к Redis (EVALSHA). После сброса кеша скриптов
+// первый вызов получает NOSCRIPT и отправляет скрипт через EVAL. Слот concurrency-лимита
+// освобождается release'ом, а если узел не успел его вызвать - через leaseTimeout.
+func (rl *RedisRateLimiter) Allow(ctx context.Context, userIP string) (bool, func(), error) {
+	lease := uuid.NewString()
+	result, err := rl.run(ctx, userIP, lease, false)
+	if err != nil {
+		return false, nil, err
 	}
-	if user.Rate == 0 {
-		user.Rate = rl.defaultRate
+	if len(result) < 3 {
+		return false, nil, fmt.Errorf("unexpected rate limit script result %v", result)
 	}
 
-	return rl.Client.Watch(ctx, func(tx *redis.Tx) error {
-		exists, err := tx.Exists(ctx, key).Result()
-		if err != nil {
-			return err
-		}
-		if exists != 0 {
-			return my_err.ErrUserAlreadyExists
+	if leased, _ := result[2].(int64); leased == 1 {
+		release := func() {
+			// клиент мог отменить запрос, но слот все равно нужно вернуть
+			rl.Client.ZRem(context.WithoutCancel(ctx), eventsKey(userIP), lease)
 		}
+		return true, release, nil
+	}
 
-		_, err = rl.Client.HSet(ctx, key,
-			"tokens", user.Capacity,
-			"last_update", time.Now().Format(TimeFormat),
-			"capacity", user.Capacity,
-			"rate", user.Rate,
-		).Result()
-
-		return err
-	})
+	allowed, _ := result[0].(int64)
+	return allowed == 1, nil, nil
 }
 
-func (rl *RedisRateLimiter) ReadClient(ctx context.Context, userIP string) (*rate_limiter.Client, error) {
-	key := "user:" + userIP + ":tokens"
-	var client *rate_limiter.Client
-
-	err := rl.Client.Watch(ctx, func(tx *redis.Tx) error {
-		exists, err := rl.Client.Exists(ctx, key).Result()
-		if err != nil {
-			return err
-		}
-		if exists == 0 {
-			return my_err.ErrUserNotFound
-		}
-
-		result, err := rl.Client.HGetAll(ctx, key).Result()
-		if err != nil {
-			return err
-		}
-		if len(result) == 0 {
-			return my_err.ErrUserNotFound
-		}
-
-		rateLimit, err := strconv.Atoi(result["rate"])
-		if err != nil {
-			return err
-		}
-		capacity, err := strconv.Atoi(result["capacity"])
-		if err != nil {
-			return err
-		}
-		lastUpdate, err := time.Parse(TimeFormat, result["last_update"])
-		if err != nil {
-			return err
-		}
-
-		tokens, err := strconv.Atoi(result["tokens"])
-		if err != nil {
-			return err
-		}
+func (rl *RedisRateLimiter) CreateClient(ctx context.Context, user *rate_limiter.Client) error {
+	p := rl.policy().Merge(user)
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	*user = *p.Client(user.ClientIP)
 
-		client = &rate_limiter.Client{
-			ClientIP: userIP,
-			TokenBucket: rate_limiter.TokenBucket{
-				Tokens:     tokens,
-				LastUpdate: lastUpdate.Unix(),
-				Capacity:   capacity,
-				Rate:       rateLimit,
-			},
-		}
+	created, err := createClientScript.Run(ctx, rl.Client, clientKeys(user.ClientIP),
+		p.Algorithm, p.Capacity, p.Rate, p.Window.Milliseconds(),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if created == 0 {
+		return my_err.ErrUserAlreadyExists
+	}
 
-		return nil
-	})
+	return nil
+}
 
+func (rl *RedisRateLimiter) ReadClient(ctx context.Context, userIP string) (*rate_limiter.Client, error) {
+	result, err := rl.run(ctx, userIP, "", true)
 	if err != nil {
 		return nil, err
 	}
+	if exists, _ := result[0].(int64); exists == 0 {
+		return nil, my_err.ErrUserNotFound
+	}
+	if len(result) < 7 {
+		return nil, fmt.Errorf("unexpected rate limit script result %v", result)
+	}
 
-	return client, nil
+	algorithm, _ := result[2].(string)
+	remaining, _ := result[1].(int64)
+	capacity, _ := result[3].(int64)
+	rateLimit, _ := result[4].(int64)
+	window, _ := result[5].(int64)
+	lastUpdate, _ := result[6].(string)
+
+	return &rate_limiter.Client{
+		ClientIP:  userIP,
+		Algorithm: algorithm,
+		WindowMs:  window,
+		TokenBucket: rate_limiter.TokenBucket{
+			Tokens:     int(remaining),
+			LastUpdate: parseLastUpdate(lastUpdate),
+			Capacity:   int(capacity),
+			Rate:       int(rateLimit),
+		},
+	}, nil
 }
 
-func (rl *RedisRateLimiter) UpdateClient(ctx context.Context, newClient *rate_limiter.Client) error {
-	key := "user:" + newClient.ClientIP + ":tokens"
+// parseLastUpdate возвращает время последнего обновления бакета в секундах. Бакеты, записанные
+// до перехода на скрипты, хранят его в RFC3339.
+func parseLastUpdate(raw string) int64 {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms).Unix()
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.Unix()
+	}
 
-	return rl.Client.Watch(ctx, func(tx *redis.Tx) error {
-		exists, err := tx.Exists(ctx, key).Result()
-		if err != nil {
-			return err
-		}
-		if exists == 0 {
-			return my_err.ErrUserNotFound
-		}
+	return 0
+}
 
-		if newClient.Capacity != 0 {
-			_, err = rl.Client.HSet(ctx, key,
-				"capacity", newClient.Capacity,
-			).Result()
-		}
-		if err != nil {
-			return err
-		}
+// UpdateClient меняет заданные (ненулевые) параметры клиента одним скриптом: текущая политика
+// читается, дополняется и проверяется в Redis, поэтому параллельное изменение не перезаписывается.
+func (rl *RedisRateLimiter) UpdateClient(ctx context.Context, newClient *rate_limiter.Client) error {
+	p := rl.policy()
+	result, err := updateClientScript.Run(ctx, rl.Client, clientKeys(newClient.ClientIP),
+		newClient.Algorithm, newClient.Capacity, newClient.Rate, newClient.WindowMs,
+		p.Algorithm, p.Capacity, p.Rate, p.Window.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return err
+	}
 
-		if newClient.Rate != 0 {
-			_, err = rl.Client.HSet(ctx, key,
-				"rate", newClient.Rate,
-			).Result()
+	switch status, _ := result[0].(int64); status {
+	case 0:
+		return my_err.ErrUserNotFound
+	case -1:
+		reason := ""
+		if len(result) > 1 {
+			reason, _ = result[1].(string)
 		}
+		return fmt.Errorf("%w: %s", my_err.ErrInvalidRateLimit, reason)
+	}
 
-		return err
-	})
+	return nil
 }
 
 func (rl *RedisRateLimiter) DeleteClient(ctx context.Context, clientIP string) error {
-	key := "user:" + clientIP + ":tokens"
+	deleted, err := rl.Client.Del(ctx, clientKeys(clientIP)...).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return my_err.ErrUserNotFound
+	}
 
-	return rl.Client.Watch(ctx, func(tx *redis.Tx) error {
-		exists, err := tx.Exists(ctx, key).Result()
-		if err != nil {
-			return err
-		}
-		if exists == 0 {
-			return my_err.ErrUserNotFound
-		}
+	return nil
+}
 
-		_, err = rl.Client.Del(ctx, key).Result()
+func clientKey(clientIP string) string {
+	return "user:" + clientIP + ":tokens"
+}
 
-		return err
-	})
+// eventsKey - sorted set с запросами клиента для sliding-log и concurrency
+func eventsKey(clientIP string) string {
+	return "user:" + clientIP + ":events"
+}
+
+func clientKeys(clientIP string) []string {
+	return []string{clientKey(clientIP), eventsKey(clientIP)}
+}
+
+func (rl *RedisRateLimiter) Close() error {
+	return rl.Client.Close()
 }
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
+)
+
+func newTestRedis(t *testing.T, algorithm string, capacity int) (*RedisRateLimiter, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	cfg := newTestConfig(algorithm, capacity)
+	cfg.Redis.Addr = mr.Addr()
+	rl := NewRedisRateLimiter(cfg)
+	t.Cleanup(func() { rl.Close() })
+
+	return rl, mr
+}
+
+func newRedisLimiter(t *testing.T, algorithm string, capacity int) RateLimiter {
+	rl, _ := newTestRedis(t, algorithm, capacity)
+	return rl
+}
+
+func TestRedisAllow(t *testing.T) {
+	testAllow(t, newRedisLimiter)
+}
+
+func TestRedisClients(t *testing.T) {
+	testClients(t, newRedisLimiter)
+}
+
+func TestRedisUpdateKeepsState(t *testing.T) {
+	testUpdateKeepsState(t, newRedisLimiter)
+}
+
+// параллельные изменения разных параметров не перезаписывают друг друга
+func TestRedisConcurrentUpdates(t *testing.T) {
+	rl, _ := newTestRedis(t, rate_limiter.AlgorithmTokenBucket, 5)
+	ctx := context.Background()
+
+	for i := range 20 {
+		ip := "10.0.0." + strconv.Itoa(i)
+		if err := rl.CreateClient(ctx, &rate_limiter.Client{ClientIP: ip}); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		for _, update := range []rate_limiter.TokenBucket{{Capacity: 10}, {Rate: 7}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := rl.UpdateClient(ctx, &rate_limiter.Client{ClientIP: ip, TokenBucket: update}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		got, err := rl.ReadClient(ctx, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Capacity != 10 || got.Rate != 7 {
+			t.Fatalf("client = %+v, want capacity 10 and rate 7", got)
+		}
+	}
+}
+
+func TestRedisLegacyClientKeepsPolicy(t *testing.T) {
+	rl, mr := newTestRedis(t, rate_limiter.AlgorithmTokenBucket, 20)
+	ctx := context.Background()
+
+	// клиент, созданный через API до появления managed
+	key := clientKey("10.0.0.1")
+	mr.HSet(key, "tokens", "3", "last_update", "2024-01-01T00:00:00Z", "capacity", "3", "rate", "1")
+
+	if allowed, _, err := rl.Allow(ctx, "10.0.0.1"); err != nil || !allowed {
+		t.Fatalf("allowed = %v, err = %v", allowed, err)
+	}
+	if ttl := mr.TTL(key); ttl != 0 {
+		t.Errorf("legacy client got TTL %s", ttl)
+	}
+	if mr.HGet(key, "managed") != "1" {
+		t.Error("legacy client is not migrated to managed")
+	}
+
+	got, err := rl.ReadClient(ctx, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Capacity != 3 || got.Rate != 1 || got.Tokens != 2 {
+		t.Errorf("client = %+v, want capacity 3, rate 1, 2 tokens left", got)
+	}
+}
+
+func TestRedisReadClientUsesStoredAlgorithm(t *testing.T) {
+	rl, _ := newTestRedis(t, rate_limiter.AlgorithmFixedWindow, 5)
+	ctx := context.Background()
+
+	for range 2 {
+		rl.Allow(ctx, "10.0.0.1")
+	}
+	rl.SetDefaults(rate_limiter.Policy{Algorithm: rate_limiter.AlgorithmTokenBucket, Capacity: 5, Rate: 1, Window: time.Minute})
+
+	got, err := rl.ReadClient(ctx, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Algorithm != rate_limiter.AlgorithmFixedWindow || got.Tokens != 3 {
+		t.Errorf("client = %+v, want fixed-window state with 3 requests left", got)
+	}
+}
+
+// roundTrips считает обращения к Redis: отдельную команду или пайплайн целиком
+type roundTrips struct {
+	count atomic.Int64
+}
+
+func (rt *roundTrips) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (rt *roundTrips) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		rt.count.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (rt *roundTrips) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		rt.count.Add(1)
+		return next(ctx, cmds)
+	}
+}
+
+var _ redis.Hook = (*roundTrips)(nil)
+
+func BenchmarkRedisAllow(b *testing.B) {
+	mr := miniredis.RunT(b)
+	cfg := newTestConfig(rate_limiter.AlgorithmTokenBucket, 1<<30)
+	cfg.Redis.Addr = mr.Addr()
+	cfg.RateLimit.DefaultRate = 1 << 30
+
+	rl := NewRedisRateLimiter(cfg)
+	defer rl.Close()
+	counter := &roundTrips{}
+	rl.Client.AddHook(counter)
+
+	ctx := context.Background()
+	if _, _, err := rl.Allow(ctx, "10.0.0.1"); err != nil {
+		b.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// flush - когда сбрасывать кеш скриптов, как после рестарта Redis: перед первым
+		// запросом (once) или перед каждым (each)
+		flush string
+		// want - ожидаемое число обращений к Redis за n запросов
+		want func(n int) int
+	}{
+		// скрипт уже в кеше: один EVALSHA
+		{name: "evalsha", want: func(n int) int { return n }},
+		// скрипт заново отправляется один раз, дальше снова один EVALSHA
+		{name: "reload", flush: "once", want: func(n int) int { return n + 1 }},
+		// EVALSHA получает NOSCRIPT, и скрипт отправляется заново через EVAL
+		{name: "noscript", flush: "each", want: func(n int) int { return 2 * n }},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			// кеш сбрасывается отдельным клиентом, чтобы не попасть в счетчик
+			admin := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer admin.Close()
+			flush := func() {
+				b.StopTimer()
+				if err := admin.ScriptFlush(ctx).Err(); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+
+			if tt.flush == "once" {
+				flush()
+			}
+			counter.count.Store(0)
+			b.ResetTimer()
+			for range b.N {
+				if tt.flush == "each" {
+					flush()
+				}
+				if _, _, err := rl.Allow(ctx, "10.0.0.1"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			got := counter.count.Load()
+			b.ReportMetric(float64(got)/float64(b.N), "roundtrips/op")
+			if want := tt.want(b.N); got != int64(want) {
+				b.Fatalf("round trips = %d for %d requests, want %d", got, b.N, want)
+			}
+		})
+	}
+}
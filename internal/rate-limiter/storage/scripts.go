@@ -0,0 +1,237 @@
+package storage
+
+import "github.com/redis/go-redis/v9"
+
+// Скрипты выполняются в Redis атомарно, поэтому проверка лимита - один EVALSHA без WATCH
+// и повторов. Время берется из Redis (TIME), чтобы у всех узлов балансировщика были одинаковые часы.
+// Клиент хранится в хеше KEYS[1]: algorithm, last_update (мс), состояние алгоритма, а у клиентов,
+// созданных через API, еще capacity, rate, window (мс) и managed - такие клиенты не удаляются по TTL.
+// Клиенты, записанные до появления managed, хранят capacity и rate без него и считаются управляемыми.
+// sliding-log и concurrency хранят запросы в sorted set KEYS[2]: время запроса или срок аренды слота.
+
+// allowScript проверяет лимит клиента по его алгоритму и учитывает запрос.
+// ARGV: алгоритм, capacity, rate и window (мс) по умолчанию, минимальный TTL (мс), срок аренды
+// слота concurrency (мс), id запроса, peek. С peek = 1 запрос не учитывается и ничего не пишется,
+// скрипт возвращает {есть ли клиент, остаток, algorithm, capacity, rate, window, last_update}.
+// Иначе возвращает {разрешен ли запрос, остаток, занят ли слот concurrency}.
+var allowScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local peek = ARGV[8] == '1'
+
+local data = redis.call('HMGET', KEYS[1], 'algorithm', 'capacity', 'rate', 'window', 'managed', 'last_update')
+if peek and redis.call('EXISTS', KEYS[1]) == 0 then
+	return {0}
+end
+
+-- клиенты, созданные через API до появления флага managed
+local legacy = not data[5] and data[2]
+local managed = data[5] == '1' or legacy
+local algorithm, capacity, rate, window = ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+-- ключи, записанные до выбора алгоритмов, хранят только token-bucket
+local stored = data[1] or 'token-bucket'
+if managed then
+	algorithm = stored
+	capacity = tonumber(data[2])
+	rate = tonumber(data[3]) or 0
+	window = tonumber(data[4]) or window
+elseif stored ~= algorithm then
+	if peek then
+		-- состояние записано прежним алгоритмом по умолчанию, остаток считается по нему
+		algorithm = stored
+	else
+		-- алгоритм по умолчанию сменился при перезагрузке конфига
+		redis.call('DEL', KEYS[1], KEYS[2])
+	end
+end
+
+local allowed, remaining, leased = 0, 0, 0
+local ttl = tonumber(ARGV[5])
+
+if algorithm == 'token-bucket' then
+	local st = redis.call('HMGET', KEYS[1], 'tokens', 'last_update')
+	local tokens = tonumber(st[1]) or capacity
+	local last = tonumber(st[2]) or now
+	tokens = math.min(capacity, tokens + math.max(0, now - last) * rate / 1000)
+	if not peek then
+		if tokens >= 1 then
+			tokens = tokens - 1
+			allowed = 1
+		end
+		redis.call('HSET', KEYS[1], 'tokens', tostring(tokens))
+	end
+	remaining = math.floor(tokens)
+	ttl = math.max(ttl, math.ceil(capacity / rate * 1000))
+elseif algorithm == 'gcra' then
+	local interval = 1000 / rate
+	local tat = math.max(tonumber(redis.call('HGET', KEYS[1], 'tat')) or now, now)
+	if not peek then
+		if tat - now <= interval * (capacity - 1) then
+			tat = tat + interval
+			allowed = 1
+		end
+		redis.call('HSET', KEYS[1], 'tat', tostring(tat))
+	end
+	remaining = math.max(0, math.floor((interval * capacity - (tat - now)) / interval))
+	ttl = math.max(ttl, math.ceil(tat - now))
+elseif algorithm == 'fixed-window' then
+	local start = now - now % window
+	local st = redis.call('HMGET', KEYS[1], 'win_start', 'count')
+	local count = 0
+	if tonumber(st[1]) == start then
+		count = tonumber(st[2]) or 0
+	end
+	if not peek then
+		if count < capacity then
+			count = count + 1
+			allowed = 1
+		end
+		redis.call('HSET', KEYS[1], 'win_start', start, 'count', count)
+	end
+	remaining = math.max(0, capacity - count)
+	ttl = math.max(ttl, window)
+elseif algorithm == 'sliding-counter' then
+	local start = now - now % window
+	local st = redis.call('HMGET', KEYS[1], 'win_start', 'count', 'prev')
+	local stored_start = tonumber(st[1])
+	local count, prev = 0, 0
+	if stored_start == start then
+		count = tonumber(st[2]) or 0
+		prev = tonumber(st[3]) or 0
+	elseif stored_start == start - window then
+		prev = tonumber(st[2]) or 0
+	end
+	local estimate = prev * (window - (now - start)) / window + count
+	if not peek then
+		if estimate + 1 <= capacity then
+			count = count + 1
+			estimate = estimate + 1
+			allowed = 1
+		end
+		redis.call('HSET', KEYS[1], 'win_start', start, 'count', count, 'prev', prev)
+	end
+	remaining = math.max(0, math.floor(capacity - estimate))
+	ttl = math.max(ttl, 2 * window)
+elseif algorithm == 'sliding-log' or algorithm == 'concurrency' then
+	-- в sliding-log score - время запроса, в concurrency - срок окончания аренды слота
+	local cutoff, score, expire = now - window, now, window
+	if algorithm == 'concurrency' then
+		expire = tonumber(ARGV[6])
+		cutoff, score = now, now + expire
+	end
+	local count = redis.call('ZCOUNT', KEYS[2], '(' .. cutoff, '+inf')
+	if not peek then
+		redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', cutoff)
+		if count < capacity then
+			redis.call('ZADD', KEYS[2], score, ARGV[7])
+			count = count + 1
+			allowed = 1
+			if algorithm == 'concurrency' then
+				leased = 1
+			end
+		end
+		redis.call('PEXPIRE', KEYS[2], expire)
+	end
+	remaining = math.max(0, capacity - count)
+	ttl = math.max(ttl, expire)
+end
+
+if peek then
+	return {1, remaining, algorithm, capacity, rate, window, data[6] or ''}
+end
+
+redis.call('HSET', KEYS[1], 'algorithm', algorithm, 'last_update', now)
+if legacy then
+	redis.call('HSET', KEYS[1], 'managed', '1')
+end
+if not managed then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+
+return {allowed, remaining, leased}
+`)
+
+// createClientScript создает клиента с пустым состоянием (полный бакет, пустое окно).
+// ARGV: algorithm, capacity, rate, window (мс). Возвращает 0, если клиент уже есть.
+var createClientScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('DEL', KEYS[2])
+redis.call('HSET', KEYS[1], 'algorithm', ARGV[1], 'capacity', ARGV[2], 'rate', ARGV[3], 'window', ARGV[4],
+	'last_update', now, 'managed', '1')
+
+return 1
+`)
+
+// updateClientScript меняет политику клиента. ARGV: новые algorithm, capacity, rate и window (мс),
+// пустые и нулевые значения не меняются; затем algorithm, capacity, rate и window по умолчанию -
+// текущая политика клиентов без своих лимитов. Чтение, слияние, проверка и запись идут в одном
+// скрипте, поэтому параллельные изменения не теряются. Проверки повторяют Policy.Validate.
+// При смене алгоритма состояние сбрасывается, token-bucket сначала пополняется по старой скорости.
+// Клиент становится управляемым и больше не удаляется по TTL.
+// Возвращает {0}, если клиента нет, {-1, причина} для невалидной политики, иначе {1}.
+var updateClientScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {0}
+end
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', KEYS[1], 'algorithm', 'capacity', 'rate', 'window', 'managed', 'tokens', 'last_update')
+local old_algorithm = data[1] or 'token-bucket'
+local old_capacity, old_rate, old_window = tonumber(ARGV[6]), tonumber(ARGV[7]), tonumber(ARGV[8])
+if data[5] == '1' or (not data[5] and data[2]) then
+	old_capacity = tonumber(data[2])
+	old_rate = tonumber(data[3]) or 0
+	old_window = tonumber(data[4]) or old_window
+end
+
+local algorithm, capacity, rate, window = old_algorithm, old_capacity, old_rate, old_window
+if ARGV[1] ~= '' then
+	algorithm = ARGV[1]
+end
+if tonumber(ARGV[2]) ~= 0 then
+	capacity = tonumber(ARGV[2])
+end
+if tonumber(ARGV[3]) ~= 0 then
+	rate = tonumber(ARGV[3])
+end
+if tonumber(ARGV[4]) ~= 0 then
+	window = tonumber(ARGV[4])
+end
+
+if algorithm == 'token-bucket' or algorithm == 'gcra' then
+	if rate < 1 then
+		return {-1, algorithm .. ' needs rate >= 1'}
+	end
+elseif algorithm == 'fixed-window' or algorithm == 'sliding-log' or algorithm == 'sliding-counter' then
+	if window < 1 then
+		return {-1, algorithm .. ' needs window >= 1ms'}
+	end
+elseif algorithm ~= 'concurrency' then
+	return {-1, 'unknown algorithm "' .. algorithm .. '"'}
+end
+if capacity < 1 then
+	return {-1, 'capacity must be positive'}
+end
+
+if algorithm ~= old_algorithm then
+	redis.call('DEL', KEYS[1], KEYS[2])
+elseif algorithm == 'token-bucket' then
+	local tokens = tonumber(data[6]) or old_capacity
+	local last = tonumber(data[7]) or now
+	tokens = math.min(old_capacity, tokens + math.max(0, now - last) * old_rate / 1000)
+	redis.call('HSET', KEYS[1], 'tokens', tostring(math.min(tokens, capacity)))
+end
+
+redis.call('HSET', KEYS[1], 'algorithm', algorithm, 'capacity', capacity, 'rate', rate, 'window', window,
+	'last_update', now, 'managed', '1')
+redis.call('PERSIST', KEYS[1])
+
+return {1}
+`)
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/logger"
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+const (
+	StorageRedis  = "redis"
+	StorageMemory = "memory"
+)
+
+// RateLimiter - хранилище лимитов: проверка лимитов, управление клиентами через API
+// и политика по умолчанию, которая меняется при перезагрузке конфига.
+// Release, возвращенный Allow, освобождает слот concurrency-лимита.
+type RateLimiter interface {
+	Allow(ctx context.Context, userIP string) (allowed bool, release func(), err error)
+	CreateClient(ctx context.Context, user *rate_limiter.Client) error
+	ReadClient(ctx context.Context, userIP string) (*rate_limiter.Client, error)
+	UpdateClient(ctx context.Context, newClient *rate_limiter.Client) error
+	DeleteClient(ctx context.Context, clientIP string) error
+	SetDefaults(policy rate_limiter.Policy)
+	Close() error
+}
+
+// NewRateLimiter создает хранилище, выбранное в rate-limit.storage. Без fallback'а
+// недоступный Redis - ошибка, с fallback'ом балансировщик стартует и проверяет лимиты в памяти.
+func NewRateLimiter(ctx context.Context, cfg *config.Config, log *slog.Logger) (RateLimiter, error) {
+	switch cfg.RateLimit.Storage {
+	case StorageMemory:
+		return NewMemoryRateLimiter(cfg), nil
+	case StorageRedis:
+	default:
+		return nil, fmt.Errorf("%w: unknown storage %q", my_err.ErrInvalidRateLimit, cfg.RateLimit.Storage)
+	}
+
+	if cfg.Redis.Addr == "" {
+		return nil, fmt.Errorf("%w: redis.addr is required for redis storage", my_err.ErrInvalidRateLimit)
+	}
+
+	redisLimiter := NewRedisRateLimiter(cfg)
+	err := redisLimiter.Client.Ping(ctx).Err()
+	if !cfg.RateLimit.Fallback {
+		if err != nil {
+			redisLimiter.Close()
+			return nil, fmt.Errorf("connecting to Redis: %w", err)
+		}
+		return redisLimiter, nil
+	}
+
+	if err != nil {
+		log.Warn("Redis is unavailable, rate limits are checked in memory until it recovers", logger.Err(err))
+	}
+
+	return NewFallbackRateLimiter(redisLimiter, NewMemoryRateLimiter(cfg), log), nil
+}
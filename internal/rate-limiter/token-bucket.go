@@ -7,7 +7,11 @@ type TokenBucket struct {
 	Rate       int   `json:"rate"`
 }
 
+// Client - лимиты клиента. Tokens - сколько запросов клиент может сделать сейчас,
+// Rate используется алгоритмами token-bucket и gcra, WindowMs - оконными алгоритмами.
 type Client struct {
-	ClientIP string `json:"client_ip"`
+	ClientIP  string `json:"client_ip"`
+	Algorithm string `json:"algorithm,omitempty"`
+	WindowMs  int64  `json:"window_ms,omitempty"`
 	TokenBucket
 }
@@ -0,0 +1,158 @@
+package reloader
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/logger"
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter"
+)
+
+type Router interface {
+	Reload(*config.Config) error
+}
+
+type RateLimitDefaults interface {
+	SetDefaults(policy rate_limiter.Policy)
+}
+
+// Reloader перечитывает конфиг по SIGHUP или при изменении файла и применяет его
+// к работающему балансировщику. Невалидный конфиг отклоняется, продолжает работать старый.
+type Reloader struct {
+	path    string
+	current *config.Config
+	router  Router
+	limiter RateLimitDefaults
+	modTime time.Time
+	mu      sync.Mutex
+	log     *slog.Logger
+}
+
+func NewReloader(path string, cfg *config.Config, router Router, limiter RateLimitDefaults, log *slog.Logger) *Reloader {
+	rl := &Reloader{
+		path:    path,
+		current: cfg,
+		router:  router,
+		limiter: limiter,
+		log:     log.With(slog.String("component", "reloader")),
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		rl.modTime = info.ModTime()
+	}
+
+	return rl
+}
+
+// Run ждет SIGHUP и, если задан watchInterval, следит за временем изменения файла конфига
+func (rl *Reloader) Run(ctx context.Context, watchInterval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var watch <-chan time.Time
+	if watchInterval > 0 {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			rl.log.Info("SIGHUP received, reloading config")
+			_ = rl.Reload()
+		case <-watch:
+			if rl.changed() {
+				rl.log.Info("config file changed, reloading config")
+				_ = rl.Reload()
+			}
+		}
+	}
+}
+
+func (rl *Reloader) Reload() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// время изменения берется до чтения: если файл поменяют во время загрузки,
+	// следующая проверка увидит новое время и перечитает его
+	info, statErr := os.Stat(rl.path)
+	cfg, err := config.Load(rl.path)
+	if err != nil {
+		rl.log.Error("config rejected, keep serving with the old one", logger.Err(err))
+		return err
+	}
+
+	if err := rl.router.Reload(cfg); err != nil {
+		rl.log.Error("config rejected, keep serving with the old one", logger.Err(err))
+		return err
+	}
+
+	rl.limiter.SetDefaults(cfg.RateLimit.DefaultPolicy())
+	rl.warnRestartRequired(cfg)
+	rl.current = cfg
+	// после перезагрузки по SIGHUP тот же файл не перечитывается повторно по таймеру
+	if statErr == nil {
+		rl.modTime = info.ModTime()
+	}
+
+	rl.log.Info("config reloaded")
+
+	return nil
+}
+
+func (rl *Reloader) changed() bool {
+	info, err := os.Stat(rl.path)
+	if err != nil {
+		rl.log.Error("failed to stat config file", logger.Err(err))
+		return false
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if info.ModTime().Equal(rl.modTime) {
+		return false
+	}
+	rl.modTime = info.ModTime()
+
+	return true
+}
+
+// warnRestartRequired логирует настройки, которые применяются только после перезапуска
+func (rl *Reloader) warnRestartRequired(cfg *config.Config) {
+	old := rl.current
+	fields := map[string]bool{
+		"env":                      old.Env != cfg.Env,
+		"balancer.port":            old.Balancer.Port != cfg.Balancer.Port,
+		"balancer.shutdownTimeout": old.ShutdownTimeout != cfg.ShutdownTimeout,
+		"balancer.shutdownDelay":   old.ShutdownDelay != cfg.ShutdownDelay,
+		"redis":                    !reflect.DeepEqual(old.Redis, cfg.Redis),
+		"admin":                    old.Admin != cfg.Admin,
+		"reload":                   old.Reload != cfg.Reload,
+		"requestID":                old.RequestID != cfg.RequestID,
+		"metrics":                  old.Metrics != cfg.Metrics,
+		"tracing":                  old.Tracing != cfg.Tracing,
+		"rate-limit.storage":       old.RateLimit.Storage != cfg.RateLimit.Storage,
+		"rate-limit.fallback":      old.RateLimit.Fallback != cfg.RateLimit.Fallback,
+		"rate-limit.shards":        old.RateLimit.Shards != cfg.RateLimit.Shards,
+		"rate-limit.idleTTL":       old.RateLimit.IdleTTL != cfg.RateLimit.IdleTTL,
+		"rate-limit.leaseTimeout":  old.RateLimit.LeaseTimeout != cfg.RateLimit.LeaseTimeout,
+	}
+
+	for field, changed := range fields {
+		if changed {
+			rl.log.Warn("config option changed but requires restart", slog.String("option", field))
+		}
+	}
+}
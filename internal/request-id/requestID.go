@@ -0,0 +1,16 @@
+package request_id
+
+import "context"
+
+// ctxKey - ключ контекста, под которым хранится идентификатор запроса
+type ctxKey struct{}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext возвращает идентификатор запроса или пустую строку, если его нет
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
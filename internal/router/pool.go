@@ -0,0 +1,414 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	bl "github.com/SlashLight/golang-balancer/internal/balancer"
+	circuit_breaker "github.com/SlashLight/golang-balancer/internal/circuit-breaker"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	health_check "github.com/SlashLight/golang-balancer/internal/health-check"
+	"github.com/SlashLight/golang-balancer/internal/logger"
+	"github.com/SlashLight/golang-balancer/internal/metrics"
+	"github.com/SlashLight/golang-balancer/internal/middleware"
+	outlier_detection "github.com/SlashLight/golang-balancer/internal/outlier-detection"
+	"github.com/SlashLight/golang-balancer/pkg/my_err"
+)
+
+// Pool - именованный пул бэкендов со своим балансировщиком и health checker'ом.
+// Health checker хранит все бэкенды пула, а в балансировщике находятся только те,
+// на которые сейчас можно отправлять трафик.
+type Pool struct {
+	Name      string
+	Checker   *health_check.HealthChecker
+	Outlier   *outlier_detection.Detector
+	Breaker   *circuit_breaker.CircuitBreaker
+	state     atomic.Pointer[poolState]
+	forwarder *middleware.Forwarder
+	metrics   *metrics.Upstream
+	stop      context.CancelFunc
+	log       *slog.Logger
+}
+
+// poolState подменяется целиком при перезагрузке конфига
+type poolState struct {
+	upstream config.Upstream
+	balancer bl.Balancer
+	policy   *middleware.RetryPolicy
+	hedger   *middleware.Hedger
+	proxies  *middleware.Proxies
+	handler  http.Handler
+}
+
+// poolUpdate - подготовленные изменения пула, которые уже не могут завершиться ошибкой
+type poolUpdate struct {
+	upstream config.Upstream
+	balancer bl.Balancer
+	policy   *middleware.RetryPolicy
+	hedger   *middleware.Hedger
+	proxies  *middleware.Proxies
+}
+
+const drainPollInterval = 100 * time.Millisecond
+
+type weightSetter interface {
+	SetWeight(backendURL string, weight int) error
+}
+
+// liveBalancer отдает health checker'у текущий балансировщик пула,
+// который может смениться при перезагрузке конфига
+type liveBalancer struct {
+	pool *Pool
+}
+
+func (lb liveBalancer) AddNewBackend(back *bl.Backend) {
+	lb.pool.Balancer().AddNewBackend(back)
+}
+
+func (lb liveBalancer) RemoveBackend(idx int) {
+	lb.pool.Balancer().RemoveBackend(idx)
+}
+
+func newPool(name string, upstream config.Upstream, forwarder *middleware.Forwarder, log *slog.Logger) (*Pool, error) {
+	balancer, err := bl.NewBalancer(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %q: %w", name, err)
+	}
+
+	policy, err := middleware.NewRetryPolicy(upstream.RetryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %q: %w", name, err)
+	}
+	hedger, err := middleware.NewHedger(upstream.Hedging)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %q: %w", name, err)
+	}
+	proxies, err := middleware.NewProxies(upstream.Transport, forwarder)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %q: %w", name, err)
+	}
+
+	poolLog := log.With(slog.String("upstream", name))
+	poolMetrics := metrics.NewUpstream(name)
+	checker, err := health_check.NewHealthChecker(upstream.HealthCheck, balancer.Backends(), poolMetrics, poolLog)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %q: %w", name, err)
+	}
+
+	pool := &Pool{
+		Name:      name,
+		Checker:   checker,
+		forwarder: forwarder,
+		metrics:   poolMetrics,
+		log:       poolLog,
+	}
+	if upstream.HealthCheck.Type == health_check.ProbePassive && !upstream.Outlier.Enabled {
+		poolLog.Warn("passive health check without outlier detection, backends are never ejected")
+	}
+	pool.Outlier = outlier_detection.NewDetector(upstream.Outlier, liveBalancer{pool: pool}, checker, poolLog)
+	pool.Breaker = circuit_breaker.NewCircuitBreaker(upstream.CircuitBreaker, liveBalancer{pool: pool}, poolMetrics, poolLog)
+	pool.setState(upstream, balancer, policy, hedger, proxies)
+
+	return pool, nil
+}
+
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.state.Load().handler.ServeHTTP(w, r)
+}
+
+// Balancer возвращает текущий балансировщик пула
+func (p *Pool) Balancer() bl.Balancer {
+	return p.state.Load().balancer
+}
+
+func (p *Pool) setState(upstream config.Upstream, balancer bl.Balancer, policy *middleware.RetryPolicy, hedger *middleware.Hedger, proxies *middleware.Proxies) {
+	p.state.Store(&poolState{
+		upstream: upstream,
+		balancer: balancer,
+		policy:   policy,
+		hedger:   hedger,
+		proxies:  proxies,
+		handler:  middleware.NewRetryHandler(balancer, proxies, p.Outlier, p.Breaker, policy, hedger, p.metrics, p.log, upstream.Retries),
+	})
+}
+
+func (p *Pool) startHealthCheck(ctx context.Context) {
+	ctx, p.stop = context.WithCancel(ctx)
+	go p.Checker.Start(ctx, liveBalancer{pool: p})
+}
+
+func (p *Pool) stopHealthCheck() {
+	if p.stop != nil {
+		p.stop()
+	}
+}
+
+// prepareUpdate проверяет новый конфиг пула. Если изменились алгоритм или его параметры,
+// заранее создается новый балансировщик.
+func (p *Pool) prepareUpdate(upstream config.Upstream) (*poolUpdate, error) {
+	if err := health_check.ValidateConfig(upstream.HealthCheck); err != nil {
+		return nil, fmt.Errorf("upstream %q: %w", p.Name, err)
+	}
+
+	// бюджеты повторов и hedging'а сохраняются, если их настройки не менялись
+	current := p.state.Load()
+	update := &poolUpdate{upstream: upstream, policy: current.policy, hedger: current.hedger, proxies: current.proxies}
+	if !reflect.DeepEqual(current.upstream.RetryPolicy, upstream.RetryPolicy) {
+		policy, err := middleware.NewRetryPolicy(upstream.RetryPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: %w", p.Name, err)
+		}
+		update.policy = policy
+	}
+	if !reflect.DeepEqual(current.upstream.Hedging, upstream.Hedging) {
+		hedger, err := middleware.NewHedger(upstream.Hedging)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: %w", p.Name, err)
+		}
+		update.hedger = hedger
+	}
+	if current.upstream.Transport != upstream.Transport {
+		proxies, err := middleware.NewProxies(upstream.Transport, p.forwarder)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: %w", p.Name, err)
+		}
+		update.proxies = proxies
+	}
+
+	if !balancerChanged(current.upstream, upstream) {
+		return update, nil
+	}
+
+	balancer, err := bl.NewBalancer(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %q: %w", p.Name, err)
+	}
+	update.balancer = balancer
+
+	return update, nil
+}
+
+// applyUpdate синхронизирует бэкенды пула с конфигом и подменяет балансировщик
+func (p *Pool) applyUpdate(update *poolUpdate) {
+	upstream := update.upstream
+	wanted := make(map[string]bool, len(upstream.Backends))
+	for _, rawURL := range upstream.Backends {
+		wanted[rawURL] = true
+	}
+
+	for _, back := range p.Backends() {
+		if !wanted[back.URL.String()] {
+			if err := p.RemoveBackend(back.URL.String()); err != nil {
+				p.log.Error("failed to remove backend on reload", slog.String("backend", back.URL.String()))
+			}
+		}
+	}
+
+	for _, rawURL := range upstream.Backends {
+		if _, err := p.Backend(rawURL); err == nil {
+			continue
+		}
+		if _, err := p.AddBackend(rawURL, upstream.Weights[rawURL]); err != nil {
+			p.log.Error("failed to add backend on reload", slog.String("backend", rawURL))
+		}
+	}
+
+	balancer := p.Balancer()
+	if update.balancer != nil {
+		balancer = update.balancer
+		for _, back := range balancer.Backends() {
+			balancer.RemoveBackend(back.Index)
+		}
+		for _, back := range p.Backends() {
+			if back.Available() {
+				balancer.AddNewBackend(back)
+			}
+		}
+		p.log.Info("balancer replaced", slog.String("algorithm", upstream.Algorithm))
+	} else {
+		for rawURL, weight := range upstream.Weights {
+			err := p.SetWeight(rawURL, weight)
+			if err != nil && !errors.Is(err, my_err.ErrWeightNotSupported) && !errors.Is(err, my_err.ErrBackendNotFound) {
+				p.log.Error("failed to update backend weight on reload", slog.String("backend", rawURL))
+			}
+		}
+	}
+
+	p.Outlier.SetConfig(upstream.Outlier)
+	p.Breaker.SetConfig(upstream.CircuitBreaker)
+	old := p.state.Load().proxies
+	p.setState(upstream, balancer, update.policy, update.hedger, update.proxies)
+	if old != update.proxies {
+		old.Close()
+	}
+	if err := p.Checker.SetConfig(upstream.HealthCheck); err != nil {
+		p.log.Error("failed to update health check config on reload", logger.Err(err))
+	}
+}
+
+// balancerChanged сообщает, нужно ли пересоздать балансировщик. Бэкенды, веса и настройки
+// health check'а применяются к текущему балансировщику без пересоздания.
+func balancerChanged(old, new config.Upstream) bool {
+	old.Backends, new.Backends = nil, nil
+	old.Weights, new.Weights = nil, nil
+	old.Retries, new.Retries = 0, 0
+	old.DrainTimeout, new.DrainTimeout = 0, 0
+	old.HealthCheck, new.HealthCheck = config.HealthChecker{}, config.HealthChecker{}
+	old.Outlier, new.Outlier = config.Outlier{}, config.Outlier{}
+	old.CircuitBreaker, new.CircuitBreaker = config.CircuitBreaker{}, config.CircuitBreaker{}
+	old.RetryPolicy, new.RetryPolicy = config.RetryPolicy{}, config.RetryPolicy{}
+	old.Hedging, new.Hedging = config.Hedging{}, config.Hedging{}
+	old.Transport, new.Transport = config.Transport{}, config.Transport{}
+
+	return !reflect.DeepEqual(old, new)
+}
+
+func (p *Pool) Backends() []*bl.Backend {
+	return p.Checker.Backends()
+}
+
+func (p *Pool) Backend(rawURL string) (*bl.Backend, error) {
+	for _, back := range p.Checker.Backends() {
+		if back.URL.String() == rawURL {
+			return back, nil
+		}
+	}
+
+	return nil, my_err.ErrBackendNotFound
+}
+
+// AddBackend создает бэкенд, добавляет его в балансировщик и регистрирует в health checker'е.
+// weight == 0 означает вес по умолчанию.
+func (p *Pool) AddBackend(rawURL string, weight int) (*bl.Backend, error) {
+	if _, err := p.Backend(rawURL); err == nil {
+		return nil, my_err.ErrBackendExists
+	}
+	if weight < 0 {
+		return nil, my_err.ErrInvalidWeight
+	}
+
+	back, err := bl.NewBackend(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if weight > 0 {
+		back.SetWeight(weight)
+	}
+
+	p.Balancer().AddNewBackend(back)
+	p.Checker.Register(back)
+	p.log.Info("backend added", slog.String("backend", rawURL))
+
+	return back, nil
+}
+
+func (p *Pool) RemoveBackend(rawURL string) error {
+	back, err := p.Backend(rawURL)
+	if err != nil {
+		return err
+	}
+
+	p.Balancer().RemoveBackend(back.Index)
+	p.Checker.Unregister(back.Index)
+	p.Outlier.Forget(back.Index)
+	p.Breaker.Forget(back.Index)
+	p.state.Load().proxies.Forget(back.Index)
+	p.metrics.ForgetBackend(rawURL)
+	p.log.Info("backend removed", slog.String("backend", rawURL))
+
+	return nil
+}
+
+// SetState включает, отключает или дренирует бэкенд. Отключенный бэкенд продолжает
+// опрашиваться health checker'ом, но не получает трафик. При дренаже бэкенд перестает
+// получать новые запросы и переходит в StateDrained, когда текущие запросы завершатся.
+func (p *Pool) SetState(rawURL string, state bl.BackendState) error {
+	back, err := p.Backend(rawURL)
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case bl.StateActive, bl.StateDisabled:
+		back.SetState(state)
+		back.Sync(p.Balancer())
+	case bl.StateDraining:
+		if back.State() == bl.StateDraining {
+			return nil
+		}
+		back.SetState(state)
+		back.Sync(p.Balancer())
+		go p.waitDrained(back)
+	default:
+		return my_err.ErrUnknownState
+	}
+
+	p.log.Info("backend state changed", slog.String("backend", rawURL), slog.String("state", string(state)))
+
+	return nil
+}
+
+// waitDrained ждет завершения запросов к бэкенду, но не дольше drainTimeout
+func (p *Pool) waitDrained(back *bl.Backend) {
+	log := p.log.With(slog.String("backend", back.URL.String()))
+	log.Info("backend draining started", slog.Int64("in_flight", back.Connections()))
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	drainTimeout := p.state.Load().upstream.DrainTimeout
+	start := time.Now()
+	timeout := time.After(drainTimeout)
+	for {
+		select {
+		case <-ticker.C:
+			if back.State() != bl.StateDraining {
+				log.Info("backend draining cancelled", slog.String("state", string(back.State())))
+				return
+			}
+			if back.Connections() > 0 {
+				continue
+			}
+
+			back.SetState(bl.StateDrained)
+			log.Info("backend drained", slog.String("duration", time.Since(start).String()))
+			return
+		case <-timeout:
+			if back.State() != bl.StateDraining {
+				return
+			}
+
+			back.SetState(bl.StateDrained)
+			log.Warn("backend drain timeout exceeded",
+				slog.Int64("in_flight", back.Connections()),
+				slog.String("timeout", drainTimeout.String()),
+			)
+			return
+		}
+	}
+}
+
+func (p *Pool) SetWeight(rawURL string, weight int) error {
+	if _, err := p.Backend(rawURL); err != nil {
+		return err
+	}
+
+	balancer := p.Balancer()
+	for {
+		if setter, ok := balancer.(weightSetter); ok {
+			return setter.SetWeight(rawURL, weight)
+		}
+
+		wrapper, ok := balancer.(interface{ Unwrap() bl.Balancer })
+		if !ok {
+			return my_err.ErrWeightNotSupported
+		}
+		balancer = wrapper.Unwrap()
+	}
+}
@@ -0,0 +1,326 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SlashLight/golang-balancer/internal/api"
+	resp "github.com/SlashLight/golang-balancer/internal/api/response"
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/metrics"
+	"github.com/SlashLight/golang-balancer/internal/middleware"
+)
+
+type route struct {
+	name       string
+	host       string
+	pathPrefix string
+	pathRegex  *regexp.Regexp
+	methods    map[string]bool
+	headers    map[string]string
+	pool       *Pool
+}
+
+// table - неизменяемый снимок маршрутов и пулов, который целиком подменяется при перезагрузке конфига
+type table struct {
+	routes      []*route
+	pools       map[string]*Pool
+	defaultPool *Pool
+}
+
+type Router struct {
+	table     atomic.Pointer[table]
+	forwarder *middleware.Forwarder
+	ctx       context.Context
+	mu        sync.Mutex
+	log       *slog.Logger
+}
+
+func NewRouter(cfg *config.Config, log *slog.Logger) (*Router, error) {
+	log = log.With(slog.String("component", "router"))
+
+	trusted, err := api.ParseTrustedProxies(cfg.Forwarding.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	forwarder, err := middleware.NewForwarder(cfg.Forwarding)
+	if err != nil {
+		return nil, err
+	}
+	api.SetTrustedProxies(trusted)
+
+	rt := &Router{
+		forwarder: forwarder,
+		log:       log,
+	}
+
+	pools := make(map[string]*Pool)
+	for name, upstream := range cfg.Pools() {
+		pool, err := newPool(name, upstream, forwarder, log)
+		if err != nil {
+			return nil, err
+		}
+		pools[name] = pool
+	}
+
+	t, err := newTable(cfg, pools)
+	if err != nil {
+		return nil, err
+	}
+	rt.table.Store(t)
+
+	return rt, nil
+}
+
+func newTable(cfg *config.Config, pools map[string]*Pool) (*table, error) {
+	t := &table{pools: pools}
+
+	for i, r := range cfg.Routes {
+		compiled, err := newRoute(r, pools)
+		if err != nil {
+			return nil, err
+		}
+		if compiled.name == "" {
+			compiled.name = strconv.Itoa(i)
+		}
+		t.routes = append(t.routes, compiled)
+	}
+
+	if name := cfg.DefaultPool(); name != "" {
+		pool, ok := pools[name]
+		if !ok {
+			return nil, fmt.Errorf("default upstream %q is not defined", name)
+		}
+		t.defaultPool = pool
+	}
+
+	return t, nil
+}
+
+func newRoute(r config.Route, pools map[string]*Pool) (*route, error) {
+	pool, ok := pools[r.Upstream]
+	if !ok {
+		return nil, fmt.Errorf("route refers to unknown upstream %q", r.Upstream)
+	}
+
+	compiled := &route{
+		name:       r.Name,
+		host:       strings.ToLower(r.Host),
+		pathPrefix: r.PathPrefix,
+		headers:    r.Headers,
+		pool:       pool,
+	}
+
+	if r.PathRegex != "" {
+		re, err := regexp.Compile(r.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("route for upstream %q: %w", r.Upstream, err)
+		}
+		compiled.pathRegex = re
+	}
+
+	if len(r.Methods) > 0 {
+		compiled.methods = make(map[string]bool, len(r.Methods))
+		for _, method := range r.Methods {
+			compiled.methods[strings.ToUpper(method)] = true
+		}
+	}
+
+	return compiled, nil
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := metrics.NewStatusRecorder(w)
+
+	name, pool := rt.match(r)
+	if pool == nil {
+		rt.log.InfoContext(r.Context(), "no route for request", slog.String("host", r.Host), slog.String("path", r.URL.Path))
+		resp.RespondError(rec, http.StatusNotFound, "no route for request", rt.log)
+		metrics.ObserveRequest(name, "", r.Method, rec.Status(), time.Since(start))
+		return
+	}
+
+	defer func() {
+		metrics.ObserveRequest(name, pool.Name, r.Method, rec.Status(), time.Since(start))
+	}()
+	pool.ServeHTTP(rec, r)
+}
+
+// match возвращает имя подходящего маршрута и его пул. Для пула по умолчанию
+// имя маршрута "default", если не подошел ни один маршрут - "none".
+func (rt *Router) match(r *http.Request) (string, *Pool) {
+	t := rt.table.Load()
+	for _, route := range t.routes {
+		if route.matches(r) {
+			return route.name, route.pool
+		}
+	}
+	if t.defaultPool == nil {
+		return "none", nil
+	}
+
+	return "default", t.defaultPool
+}
+
+// BackendStates возвращает состояние всех бэкендов для метрик
+func (rt *Router) BackendStates() []metrics.BackendState {
+	var states []metrics.BackendState
+	for _, pool := range rt.Pools() {
+		for _, back := range pool.Backends() {
+			states = append(states, metrics.BackendState{
+				Upstream:  pool.Name,
+				Backend:   back.URL.String(),
+				Alive:     back.IsAlive(),
+				Available: back.Available(),
+				InFlight:  back.Connections(),
+				Breaker:   string(pool.Breaker.State(back)),
+			})
+		}
+	}
+
+	return states
+}
+
+// Pools возвращает все пулы роутера по именам
+func (rt *Router) Pools() map[string]*Pool {
+	return rt.table.Load().pools
+}
+
+func (rt *Router) Pool(name string) (*Pool, bool) {
+	pool, ok := rt.table.Load().pools[name]
+	return pool, ok
+}
+
+// StartHealthChecks запускает health checker каждого пула в отдельной горутине.
+// Проверки останавливаются при отмене ctx.
+func (rt *Router) StartHealthChecks(ctx context.Context) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.ctx = ctx
+	for _, pool := range rt.table.Load().pools {
+		pool.startHealthCheck(ctx)
+	}
+}
+
+// Reload применяет новый конфиг к работающему роутеру: обновляет бэкенды и настройки
+// существующих пулов, создает новые пулы и останавливает удаленные. Если конфиг
+// не удается применить, текущие маршруты и пулы остаются без изменений.
+func (rt *Router) Reload(cfg *config.Config) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	trusted, err := api.ParseTrustedProxies(cfg.Forwarding.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	if err := middleware.ValidateForwarding(cfg.Forwarding); err != nil {
+		return err
+	}
+
+	old := rt.table.Load()
+	upstreams := cfg.Pools()
+
+	pools := make(map[string]*Pool, len(upstreams))
+	updates := make(map[string]*poolUpdate)
+	for name, upstream := range upstreams {
+		if pool, ok := old.pools[name]; ok {
+			update, err := pool.prepareUpdate(upstream)
+			if err != nil {
+				return err
+			}
+			updates[name] = update
+			pools[name] = pool
+			continue
+		}
+
+		pool, err := newPool(name, upstream, rt.forwarder, rt.log)
+		if err != nil {
+			return err
+		}
+		pools[name] = pool
+	}
+
+	t, err := newTable(cfg, pools)
+	if err != nil {
+		return err
+	}
+
+	for name, update := range updates {
+		pools[name].applyUpdate(update)
+	}
+	api.SetTrustedProxies(trusted)
+	// конфиг уже проверен в ValidateForwarding
+	_ = rt.forwarder.SetConfig(cfg.Forwarding)
+
+	for name, pool := range pools {
+		if _, existed := old.pools[name]; !existed {
+			if rt.ctx != nil {
+				pool.startHealthCheck(rt.ctx)
+			}
+			rt.log.Info("upstream added", slog.String("upstream", name))
+		}
+	}
+
+	rt.table.Store(t)
+
+	for name, pool := range old.pools {
+		if _, ok := pools[name]; !ok {
+			pool.stopHealthCheck()
+			metrics.ForgetUpstream(name)
+			rt.log.Info("upstream removed", slog.String("upstream", name))
+		}
+	}
+
+	return nil
+}
+
+func (rt *route) matches(r *http.Request) bool {
+	if rt.host != "" && !matchHost(rt.host, r.Host) {
+		return false
+	}
+	if rt.pathPrefix != "" && !strings.HasPrefix(r.URL.Path, rt.pathPrefix) {
+		return false
+	}
+	if rt.pathRegex != nil && !rt.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+	if rt.methods != nil && !rt.methods[r.Method] {
+		return false
+	}
+	for name, value := range rt.headers {
+		got := r.Header.Get(name)
+		if value == "*" && got != "" {
+			continue
+		}
+		if got != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchHost сравнивает Host без порта. Шаблон вида "*.example.com" подходит для любого поддомена.
+func matchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+
+	return host == pattern
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/SlashLight/golang-balancer/internal/metrics"
+	request_id "github.com/SlashLight/golang-balancer/internal/request-id"
+)
+
+// Middleware начинает спан на каждый входящий запрос, продолжая трейс из traceparent клиента
+func Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("http.request.host", r.Host),
+				attribute.String("balancer.request_id", request_id.FromContext(r.Context())),
+			),
+		)
+		defer span.End()
+
+		rec := metrics.NewStatusRecorder(w)
+		defer func() {
+			status := rec.Status()
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		}()
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
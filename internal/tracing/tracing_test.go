@@ -0,0 +1,184 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/SlashLight/golang-balancer/internal/config"
+	"github.com/SlashLight/golang-balancer/internal/middleware"
+	"github.com/SlashLight/golang-balancer/internal/rate-limiter/storage"
+	"github.com/SlashLight/golang-balancer/internal/router"
+	"github.com/SlashLight/golang-balancer/internal/tracing"
+)
+
+// collector - OTLP/HTTP приемник спанов вместо настоящего коллектора
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	c.mu.Unlock()
+
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+// span находит спан по имени или префиксу имени
+func (c *collector) span(t *testing.T, prefix string) *tracepb.Span {
+	t.Helper()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if strings.HasPrefix(span.Name, prefix) {
+			return span
+		}
+	}
+
+	t.Fatalf("span %q not exported", prefix)
+	return nil
+}
+
+func loadConfig(t *testing.T, backendURL, redisAddr string) *config.Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	raw := fmt.Sprintf(`
+balancer:
+  port: 8080
+  algorithm: round-robin
+  backends:
+    - %q
+redis:
+  addr: %q
+`, backendURL, redisAddr)
+	if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+func TestRequestSpansAreExported(t *testing.T) {
+	spans := &collector{}
+	receiver := httptest.NewServer(spans)
+	defer receiver.Close()
+
+	traceparent := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent <- r.Header.Get("traceparent")
+	}))
+	defer backend.Close()
+
+	redis := miniredis.RunT(t)
+	cfg := loadConfig(t, backend.URL, redis.Addr())
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	shutdown, err := tracing.Setup(context.Background(), config.Tracing{
+		Enabled:     true,
+		Endpoint:    receiver.URL + "/v1/traces",
+		Insecure:    true,
+		SampleRatio: 1,
+		ServiceName: "golang-balancer-test",
+		Timeout:     5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, err := storage.NewRateLimiter(context.Background(), cfg, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limiter.Close()
+	rt, err := router.NewRouter(cfg, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := tracing.Middleware(middleware.RateLimitMiddleware(limiter, log)(rt))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	server := spans.span(t, http.MethodGet)
+	rateLimit := spans.span(t, "rate limit")
+	attempt := spans.span(t, "backend attempt")
+	// EVALSHA, а при пустом кеше скриптов еще и EVAL
+	redisCmd := spans.span(t, "redis eval")
+
+	if server.ParentSpanId != nil {
+		t.Errorf("server span has parent %x, want root", server.ParentSpanId)
+	}
+	for _, child := range []*tracepb.Span{rateLimit, attempt} {
+		if string(child.ParentSpanId) != string(server.SpanId) {
+			t.Errorf("span %q parent = %x, want server span %x", child.Name, child.ParentSpanId, server.SpanId)
+		}
+	}
+	if string(redisCmd.ParentSpanId) != string(rateLimit.SpanId) {
+		t.Errorf("span %q parent = %x, want rate limit span %x", redisCmd.Name, redisCmd.ParentSpanId, rateLimit.SpanId)
+	}
+	for _, span := range []*tracepb.Span{rateLimit, attempt, redisCmd} {
+		if string(span.TraceId) != string(server.TraceId) {
+			t.Errorf("span %q trace = %x, want %x", span.Name, span.TraceId, server.TraceId)
+		}
+	}
+
+	// traceparent: version-trace_id-parent_id-flags, родитель - спан попытки
+	got := strings.Split(<-traceparent, "-")
+	if len(got) != 4 {
+		t.Fatalf("backend got traceparent %q", strings.Join(got, "-"))
+	}
+	if got[1] != hex.EncodeToString(server.TraceId) {
+		t.Errorf("backend trace id = %s, want %x", got[1], server.TraceId)
+	}
+	if got[2] != hex.EncodeToString(attempt.SpanId) {
+		t.Errorf("backend parent span = %s, want backend attempt %x", got[2], attempt.SpanId)
+	}
+}
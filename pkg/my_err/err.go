@@ -5,10 +5,24 @@ import (
 )
 
 var (
-	ErrNoClientAddr      = errors.New("empty client IP and port")
-	ErrNoAliveBackends   = errors.New("no alive backends")
-	ErrParsingBackendURL = errors.New("error at parsing backend URL")
-	ErrUnknownAlgorithm  = errors.New("unknown balancing algorithm")
-	ErrUserNotFound      = errors.New("user not found")
-	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrNoClientAddr        = errors.New("empty client IP and port")
+	ErrNoAliveBackends     = errors.New("no alive backends")
+	ErrParsingBackendURL   = errors.New("error at parsing backend URL")
+	ErrUnknownAlgorithm    = errors.New("unknown balancing algorithm")
+	ErrUnknownHashFunction = errors.New("unknown hash function")
+	ErrInvalidHashKey      = errors.New("invalid hash key")
+	ErrInvalidWeight       = errors.New("backend weight must be positive")
+	ErrBackendNotFound     = errors.New("backend not found")
+	ErrBackendExists       = errors.New("backend already exists")
+	ErrWeightNotSupported  = errors.New("balancing algorithm doesn't support weights")
+	ErrUnknownState        = errors.New("unknown backend state")
+	ErrInvalidHealthCheck  = errors.New("invalid health check config")
+	ErrProbeClosed         = errors.New("health check probe is closed")
+	ErrInvalidRetryPolicy  = errors.New("invalid retry policy")
+	ErrInvalidTransport    = errors.New("invalid transport config")
+	ErrInvalidForwarding   = errors.New("invalid forwarding config")
+	ErrInvalidTracing      = errors.New("invalid tracing config")
+	ErrInvalidRateLimit    = errors.New("invalid rate limit config")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUserAlreadyExists   = errors.New("user already exists")
 )